@@ -0,0 +1,233 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// EvictPolicy decides which value is evicted when the capacity of the emap is exceeded.
+type EvictPolicy int
+
+const (
+	// LRU evicts the least recently used value.
+	LRU EvictPolicy = iota
+	// LFU evicts the least frequently used value, the least recently inserted one if there is a tie.
+	LFU
+)
+
+// WithMaxEntries limits the total key number in the emap.
+// When a new value is inserted into a full emap, a value is evicted by the evict policy, LRU by default,
+// and the evict callback is called with reason EvictCapacity.
+// A value is used when it is inserted or fetched by FetchByKey or FetchByIndex.
+func WithMaxEntries(max int) Option {
+	return func(c *config) {
+		c.maxEntries = max
+	}
+}
+
+// Sizer estimates the size in bytes of a key-value pair in the emap.
+type Sizer func(key interface{}, value interface{}) int
+
+// WithMaxSize limits the total size of the values in the emap estimated by the input sizer.
+// The size of a value is estimated once when it is inserted.
+// When the budget is exceeded, values are evicted by the evict policy, LRU by default,
+// and the evict callback is called with reason EvictSize.
+// Try to insert a value larger than the whole budget will cause an error return.
+func WithMaxSize(budget int, sizer Sizer) Option {
+	return func(c *config) {
+		c.maxSize = budget
+		c.sizer = sizer
+	}
+}
+
+// WithEvictPolicy sets the evict policy used when the capacity of the emap is exceeded.
+func WithEvictPolicy(policy EvictPolicy) Option {
+	return func(c *config) {
+		c.evictPolicy = policy
+	}
+}
+
+// policy tracks the usage of the keys and chooses the victim to evict.
+type policy[K comparable] interface {
+	add(key K)
+	access(key K)
+	remove(key K)
+	victim() (K, bool)
+}
+
+func newPolicy[K comparable](kind EvictPolicy) policy[K] {
+	if kind == LFU {
+		return &lfu[K]{entries: make(map[K]*lfuEntry[K])}
+	}
+
+	return &lru[K]{order: list.New(), entries: make(map[K]*list.Element)}
+}
+
+// lru keeps the keys in a list with the most recently used one at the front.
+type lru[K comparable] struct {
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+func (p *lru[K]) add(key K) {
+	p.entries[key] = p.order.PushFront(key)
+}
+
+func (p *lru[K]) access(key K) {
+	if e, exist := p.entries[key]; exist {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lru[K]) remove(key K) {
+	if e, exist := p.entries[key]; exist {
+		p.order.Remove(e)
+		delete(p.entries, key)
+	}
+}
+
+func (p *lru[K]) victim() (K, bool) {
+	if e := p.order.Back(); e != nil {
+		return e.Value.(K), true
+	}
+
+	var zero K
+	return zero, false
+}
+
+type lfuEntry[K comparable] struct {
+	key  K
+	freq uint64
+	seq  uint64
+	pos  int
+}
+
+// lfu keeps the keys in a min-heap ordered by the use frequency and then the insertion sequence.
+type lfu[K comparable] struct {
+	heap    []*lfuEntry[K]
+	entries map[K]*lfuEntry[K]
+	seq     uint64
+}
+
+func (p *lfu[K]) Len() int { return len(p.heap) }
+
+func (p *lfu[K]) Less(i, j int) bool {
+	if p.heap[i].freq != p.heap[j].freq {
+		return p.heap[i].freq < p.heap[j].freq
+	}
+
+	return p.heap[i].seq < p.heap[j].seq
+}
+
+func (p *lfu[K]) Swap(i, j int) {
+	p.heap[i], p.heap[j] = p.heap[j], p.heap[i]
+	p.heap[i].pos = i
+	p.heap[j].pos = j
+}
+
+func (p *lfu[K]) Push(x interface{}) {
+	e := x.(*lfuEntry[K])
+	e.pos = len(p.heap)
+	p.heap = append(p.heap, e)
+}
+
+func (p *lfu[K]) Pop() interface{} {
+	e := p.heap[len(p.heap)-1]
+	p.heap[len(p.heap)-1] = nil
+	p.heap = p.heap[:len(p.heap)-1]
+	return e
+}
+
+func (p *lfu[K]) add(key K) {
+	p.seq++
+	e := &lfuEntry[K]{key: key, freq: 1, seq: p.seq}
+	heap.Push(p, e)
+	p.entries[key] = e
+}
+
+func (p *lfu[K]) access(key K) {
+	if e, exist := p.entries[key]; exist {
+		e.freq++
+		heap.Fix(p, e.pos)
+	}
+}
+
+func (p *lfu[K]) remove(key K) {
+	if e, exist := p.entries[key]; exist {
+		heap.Remove(p, e.pos)
+		delete(p.entries, key)
+	}
+}
+
+func (p *lfu[K]) victim() (K, bool) {
+	if len(p.heap) > 0 {
+		return p.heap[0].key, true
+	}
+
+	var zero K
+	return zero, false
+}
+
+// used records the use of the input key in the evict policy.
+// Only the read locker is required since the policy has its own locker.
+func (s *store[K, V, I]) used(key K) {
+	if s.policy == nil {
+		return
+	}
+
+	s.pmtx.Lock()
+	s.policy.access(key)
+	s.pmtx.Unlock()
+}
+
+// measure estimates the size of the input value by the sizer.
+// Try to measure a value larger than the whole budget will cause an error return.
+func (s *store[K, V, I]) measure(key K, value V) (int, error) {
+	if s.sizer == nil {
+		return 0, nil
+	}
+
+	size := s.sizer(key, value)
+	if s.maxSize > 0 && size > s.maxSize {
+		return 0, &ValueError{Value: value, Err: ErrTooLarge}
+	}
+
+	return size, nil
+}
+
+// admit adds the newly inserted key to the evict policy after evicting the values exceeding the limits.
+func (s *store[K, V, I]) admit(key K) {
+	if s.policy == nil {
+		return
+	}
+
+	s.shrink()
+	s.pmtx.Lock()
+	s.policy.add(key)
+	s.pmtx.Unlock()
+}
+
+// shrink evicts the values chosen by the evict policy until neither the capacity nor the size budget is exceeded.
+// It is called before the newly inserted key is added to the policy, so the new value is never the victim.
+func (s *store[K, V, I]) shrink() {
+	for {
+		reason := EvictCapacity
+		if s.maxEntries <= 0 || len(s.values) <= s.maxEntries {
+			if s.maxSize <= 0 || s.size <= s.maxSize {
+				return
+			}
+			reason = EvictSize
+		}
+
+		s.pmtx.Lock()
+		key, ok := s.policy.victim()
+		s.pmtx.Unlock()
+		if !ok {
+			return
+		}
+
+		s.deleteByKey(key, reason)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"time"
+)
+
+// load returns the value of the input key with the write locker held.
+// An expired value is deleted on the spot if lazy expiration is enabled, as if it had been collected.
+func (s *store[K, V, I]) load(key K, now time.Time) (V, bool) {
+	value, exist := s.values[key]
+	if !exist {
+		return value, false
+	}
+
+	if s.lazy && s.isExpired(key, value, now) {
+		s.deleteByKey(key, EvictExpired)
+		var zero V
+		return zero, false
+	}
+
+	return value, true
+}
+
+// compute replaces, inserts or deletes the value of the input key by the result of the callback function.
+// Any error returned by the callback function will interrupt the computing and the error will be returned.
+func (s *store[K, V, I]) compute(key K, callback func(V, bool) (V, bool, error)) error {
+	old, exist := s.load(key, time.Now())
+	value, keep, err := callback(old, exist)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case keep && exist:
+		return s.update(key, value)
+	case keep:
+		return s.insert(key, value)
+	case exist:
+		return s.deleteByKey(key, EvictDeleted)
+	}
+
+	return nil
+}
+
+// compareAndSwap replaces the value of the input key only if the current value equals to old.
+func (s *store[K, V, I]) compareAndSwap(key K, old V, value V) (bool, error) {
+	current, exist := s.load(key, time.Now())
+	if !exist {
+		return false, &KeyError{Key: key, Err: ErrKeyNotFound}
+	}
+
+	if !equal(current, old) {
+		return false, nil
+	}
+
+	return true, s.update(key, value)
+}
+
+// loadOrStore returns the value of the input key if it exists, otherwise it inserts the input value.
+func (s *store[K, V, I]) loadOrStore(key K, value V, indices ...I) (V, bool, error) {
+	now := time.Now()
+	if current, exist := s.load(key, now); exist {
+		s.accessed(key, now)
+		return current, true, nil
+	}
+
+	if err := s.insert(key, value, indices...); err != nil {
+		var zero V
+		return zero, false, err
+	}
+
+	return value, false, nil
+}
+
+// equal compares the two values with ==.
+// Values of uncomparable types, such as slices and maps, are never equal instead of causing a panic.
+func equal[V any](a V, b V) (eq bool) {
+	defer func() {
+		if recover() != nil {
+			eq = false
+		}
+	}()
+
+	return any(a) == any(b)
+}
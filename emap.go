@@ -0,0 +1,67 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+// EMap is the interface implemented by all the emaps of this package.
+// The generic, strict and unlock emaps implement EMap[interface{}, interface{}, interface{}],
+// while the typed emaps implement EMap[K, V, I] with their own type parameters.
+// Accept an EMap instead of a concrete emap if the caller should be able to choose the variant,
+// e.g. a locked emap in production and an unlock emap in an event loop or a test.
+type EMap[K comparable, V any, I comparable] interface {
+	// Insert pushes a new value into emap with input key and indices.
+	Insert(key K, value V, indices ...I) error
+	// Upsert pushes the value into emap with input key and indices, replacing the value and the indices if the key exists.
+	Upsert(key K, value V, indices ...I) error
+	// Update replaces the value in the emap of the input key in place, the indices of the key are kept.
+	Update(key K, value V) error
+	// FetchByKey gets the value in the emap by input key.
+	FetchByKey(key K) (V, error)
+	// FetchByIndex gets the all values in the emap by input index.
+	FetchByIndex(index I) ([]V, error)
+	// FetchOneByIndex gets the first value in the emap by input index.
+	FetchOneByIndex(index I) (V, error)
+	// FetchKeysByIndex gets the all keys in the emap by input index.
+	FetchKeysByIndex(index I) ([]K, error)
+	// FetchEntriesByIndex gets the all key-value pairs in the emap by input index.
+	FetchEntriesByIndex(index I) ([]KeyValue[K, V], error)
+	// FetchIndicesByKey gets the all indices in the emap by input key.
+	FetchIndicesByKey(key K) ([]I, error)
+	// DeleteByKey deletes the value in the emap by input key.
+	DeleteByKey(key K) error
+	// DeleteByIndex deletes all the values in the emap by input index.
+	DeleteByIndex(index I) error
+	// AddIndex add the input index to the value in the emap of the input key.
+	AddIndex(key K, index I) error
+	// RemoveIndex remove the input index from the value in the emap of the input key.
+	RemoveIndex(key K, index I) error
+	// KeyNum returns the total key number in the emap.
+	KeyNum() int
+	// KeyNumOfIndex returns the total key number of the input index in the emap.
+	KeyNumOfIndex(index I) int
+	// IndexNum returns the total index number in the emap.
+	IndexNum() int
+	// IndexNumOfKey returns the total index number of the input key in the emap.
+	IndexNumOfKey(key K) int
+	// HasKey returns if the input key exists in the emap.
+	HasKey(key K) bool
+	// HasIndex returns if the input index exists in the emap.
+	HasIndex(index I) bool
+	// Transform applies the input callback function to each key-value pair and returns a new golang map.
+	Transform(callback func(K, V) (V, error)) (map[K]V, error)
+	// Foreach applies the input callback function to each key-value pair in the emap.
+	Foreach(callback func(K, V))
+	// ForeachUntil applies the input callback function to each key-value pair in the emap until it returns false.
+	ForeachUntil(callback func(K, V) bool)
+	// ForeachErr applies the input callback function to each key-value pair in the emap until it returns an error.
+	ForeachErr(callback func(K, V) error) error
+	// ForeachByIndex applies the input callback function to each key-value pair of the input index in the emap.
+	ForeachByIndex(index I, callback func(K, V))
+}
+
+var (
+	_ EMap[interface{}, interface{}, interface{}] = (*GenericEMap)(nil)
+	_ EMap[interface{}, interface{}, interface{}] = (*StrictEMap)(nil)
+	_ EMap[interface{}, interface{}, interface{}] = (*UnlockEMap)(nil)
+	_ EMap[string, int, string]                   = (*TypedEMap[string, int, string])(nil)
+	_ EMap[string, int, string]                   = (*TypedUnlockEMap[string, int, string])(nil)
+)
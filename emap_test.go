@@ -3,34 +3,19 @@
 package emap
 
 import (
+	"context"
 	"errors"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	"math/rand"
+	"sort"
 	"time"
 )
 
-type EMap interface {
-	Insert(key interface{}, value interface{}, indices ...interface{}) error
-	FetchByKey(key interface{}) (interface{}, error)
-	FetchByIndex(index interface{}) ([]interface{}, error)
-	DeleteByKey(key interface{}) error
-	DeleteByIndex(index interface{}) error
-	AddIndex(key interface{}, index interface{}) error
-	RemoveIndex(key interface{}, index interface{}) error
-	KeyNum() int
-	KeyNumOfIndex(index interface{}) int
-	IndexNum() int
-	IndexNumOfKey(key interface{}) int
-	HasKey(key interface{}) bool
-	HasIndex(index interface{}) bool
-	Transform(callback func(interface{}, interface{}) (interface{}, error)) (map[interface{}]interface{}, error)
-	Foreach(callback func(interface{}, interface{}))
-}
-
 var _ = Describe("Tests of emap", func() {
 	Context("one unique key and multi indices", func() {
-		DescribeTable("Given an empty emap, when add a new item, it should be able to get by key or index later.", func(emap EMap) {
+		DescribeTable("Given an empty emap, when add a new item, it should be able to get by key or index later.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			Expect(emap.HasKey("key1")).To(Equal(false))
 			err := emap.Insert("key1", "value1", "index1", "index2", "index3")
 			Expect(err).ShouldNot(HaveOccurred())
@@ -56,7 +41,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap with key1, when add a new item with the same key1, it should fail.", func(emap EMap) {
+		DescribeTable("Given an emap with key1, when add a new item with the same key1, it should fail.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			err := emap.Insert("key1", "value1", "index1", "index2")
 			Expect(err).ShouldNot(HaveOccurred())
 
@@ -72,7 +57,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an empty emap, when delete a item with the key1, it should fail.", func(emap EMap) {
+		DescribeTable("Given an empty emap, when delete a item with the key1, it should fail.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			err := emap.DeleteByKey("key1")
 			Expect(err).Should(HaveOccurred())
 		},
@@ -81,7 +66,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap with multi values, when delete by key, it should delete the value and indices of the key.", func(emap EMap) {
+		DescribeTable("Given an emap with multi values, when delete by key, it should delete the value and indices of the key.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			err := emap.Insert("key1", "value1", "index1", "index2")
 			Expect(err).ShouldNot(HaveOccurred())
 			err = emap.Insert("key2", "value2", "index3")
@@ -118,7 +103,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap without key1, when add index by key1, it should fail.", func(emap EMap) {
+		DescribeTable("Given an emap without key1, when add index by key1, it should fail.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			err := emap.Insert("key2", "value2")
 			Expect(err).ShouldNot(HaveOccurred())
 			err = emap.AddIndex("key1", "index1")
@@ -131,7 +116,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap with key1 and index1, when add index1 to key1 again, it should fail.", func(emap EMap) {
+		DescribeTable("Given an emap with key1 and index1, when add index1 to key1 again, it should fail.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			emap.Insert("key1", "value1", "index1")
 			err := emap.AddIndex("key1", "index1")
 			Expect(err).Should(HaveOccurred())
@@ -141,7 +126,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap with key1, when add new index by key1, it should get key1's value by the new indices later.", func(emap EMap) {
+		DescribeTable("Given an emap with key1, when add new index by key1, it should get key1's value by the new indices later.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			err := emap.Insert("key1", "value1")
 			Expect(err).ShouldNot(HaveOccurred())
 			Expect(emap.IndexNum()).To(BeEquivalentTo(0))
@@ -166,7 +151,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap with key1 and index1, when remove index2 from key1, it should fail.", func(emap EMap) {
+		DescribeTable("Given an emap with key1 and index1, when remove index2 from key1, it should fail.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			emap.Insert("key1", "value1", "index1")
 			err := emap.RemoveIndex("key1", "index2")
 			Expect(err).Should(HaveOccurred())
@@ -176,7 +161,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap with key1 and index1, when remove index from a non-existed key, it should fail.", func(emap EMap) {
+		DescribeTable("Given an emap with key1 and index1, when remove index from a non-existed key, it should fail.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			emap.Insert("key1", "value1", "index1")
 			err := emap.RemoveIndex("key2", "index1")
 			Expect(err).Should(HaveOccurred())
@@ -188,7 +173,7 @@ var _ = Describe("Tests of emap", func() {
 	})
 
 	Context("multi key and one index", func() {
-		DescribeTable("Given an empty emap, when add values with different keys but same index, it should be able to get all values by the index.", func(emap EMap) {
+		DescribeTable("Given an empty emap, when add values with different keys but same index, it should be able to get all values by the index.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			Expect(emap.HasIndex("index1")).To(Equal(false))
 			err := emap.Insert("key1", "value1", "index1", "index2")
 			Expect(emap.HasIndex("index1")).To(Equal(true))
@@ -214,7 +199,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap with multi keys with same index, when delete index by key, it should not affect other keys.", func(emap EMap) {
+		DescribeTable("Given an emap with multi keys with same index, when delete index by key, it should not affect other keys.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			err := emap.Insert("key1", "value1", "index1", "index2")
 			Expect(err).ShouldNot(HaveOccurred())
 			err = emap.Insert("key2", "value2", "index1")
@@ -247,7 +232,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap with multi keys and indices, when remove item by key, it should remove the related value and indices.", func(emap EMap) {
+		DescribeTable("Given an emap with multi keys and indices, when remove item by key, it should remove the related value and indices.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			err := emap.Insert("key1", "value1", "index1", "index2")
 			Expect(err).ShouldNot(HaveOccurred())
 			err = emap.Insert("key2", "value2", "index2")
@@ -272,7 +257,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap with multi keys and indices, when delete a item with a non-existed index, it should fail.", func(emap EMap) {
+		DescribeTable("Given an emap with multi keys and indices, when delete a item with a non-existed index, it should fail.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			err := emap.Insert("key1", "value1", "index1", "index2")
 			Expect(err).ShouldNot(HaveOccurred())
 			err = emap.Insert("key2", "value2", "index2")
@@ -286,7 +271,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap with multi keys and indices, when remove item by index, it should remove all values related.", func(emap EMap) {
+		DescribeTable("Given an emap with multi keys and indices, when remove item by index, it should remove all values related.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			err := emap.Insert("key1", "value1", "index1", "index2")
 			Expect(err).ShouldNot(HaveOccurred())
 			err = emap.Insert("key2", "value2", "index2")
@@ -313,7 +298,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap with multi keys and indices, when add a existed index to another value, it should be able to get all values by the index later.", func(emap EMap) {
+		DescribeTable("Given an emap with multi keys and indices, when add a existed index to another value, it should be able to get all values by the index later.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			err := emap.Insert("key1", "value1", "index1", "index")
 			Expect(err).ShouldNot(HaveOccurred())
 			err = emap.Insert("key2", "value2", "index2")
@@ -335,7 +320,7 @@ var _ = Describe("Tests of emap", func() {
 
 	Context("expirable values", func() {
 		var (
-			emap EMap
+			emap *GenericEMap
 		)
 
 		BeforeEach(func() {
@@ -343,6 +328,7 @@ var _ = Describe("Tests of emap", func() {
 		})
 
 		AfterEach(func() {
+			emap.Close()
 			emap = nil
 		})
 
@@ -373,6 +359,246 @@ var _ = Describe("Tests of emap", func() {
 			time.Sleep(time.Second)
 			Expect(emap.HasKey("key1")).To(Equal(false))
 		})
+
+		It("Given an expirable emap, when a plain value is inserted with a ttl, it should be collected after the ttl.", func() {
+			type testStruct struct {
+				data string
+			}
+
+			err := emap.InsertWithTTL("key1", &testStruct{"value1"}, 300*time.Millisecond, "index1", "index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			err = emap.InsertWithTTL("key2", &testStruct{"value2"}, 0, "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.KeyNumOfIndex("index1")).To(Equal(2))
+
+			time.Sleep(600 * time.Millisecond)
+			Expect(emap.HasKey("key1")).To(Equal(false))
+			Expect(emap.HasIndex("index2")).To(Equal(false))
+			Expect(emap.KeyNumOfIndex("index1")).To(Equal(1))
+			Expect(emap.HasKey("key2")).To(Equal(true))
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+		})
+
+		It("Given an expirable emap with a default ttl, when plain values are inserted, they should be collected after the ttl.", func() {
+			another := NewExpirableEMap(100, WithTTL(300*time.Millisecond))
+			defer another.Close()
+
+			err := another.Insert("key1", "value1", "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			err = another.InsertWithTTL("key2", "value2", time.Hour, "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			time.Sleep(600 * time.Millisecond)
+			Expect(another.HasKey("key1")).To(Equal(false))
+			Expect(another.HasKey("key2")).To(Equal(true))
+			Expect(another.KeyNumOfIndex("index1")).To(Equal(1))
+		})
+
+		It("Given values with different ttls, when the deadlines are due, it should delete only the due values in bounded batches.", func() {
+			another := NewExpirableEMap(int(time.Hour / time.Millisecond))
+			defer another.Close()
+			for i := 1; i <= 5; i++ {
+				err := another.InsertWithTTL(i, i, time.Duration(i)*time.Hour, "index")
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+			another.InsertWithTTL(0, 0, 0, "index")
+			now := time.Now()
+			Expect(another.schedules.Len()).To(Equal(5))
+
+			Expect(another.expireDue(now, 10)).To(Equal(0))
+			Expect(another.expireDue(now.Add(3*time.Hour), 2)).To(Equal(2))
+			Expect(another.HasKey(1)).To(Equal(false))
+			Expect(another.HasKey(2)).To(Equal(false))
+			Expect(another.HasKey(3)).To(Equal(true))
+			Expect(another.expireDue(now.Add(3*time.Hour), 2)).To(Equal(1))
+			Expect(another.HasKey(3)).To(Equal(false))
+
+			err := another.DeleteByKey(5)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(another.schedules.Len()).To(Equal(1))
+			Expect(another.expireDue(now.Add(time.Hour*24), 10)).To(Equal(1))
+			Expect(another.KeyNum()).To(Equal(1))
+			Expect(another.KeyNumOfIndex("index")).To(Equal(1))
+			Expect(another.check()).ShouldNot(HaveOccurred())
+		})
+
+		It("Given an expirable emap with a small expiration batch, when many values expire, it should collect all of them.", func() {
+			another := NewExpirableEMap(100, WithTTL(100*time.Millisecond), WithExpirationBatch(3))
+			defer another.Close()
+
+			for i := 0; i < 10; i++ {
+				err := another.Insert(i, i, "index")
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+			values := make([]*expirebleStruct, 10)
+			for i := range values {
+				values[i] = &expirebleStruct{false, i}
+				err := another.InsertWithTTL(i+10, values[i], 0, "expirable")
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+			another.mtx.Lock()
+			for _, value := range values {
+				value.expired = true
+			}
+			another.mtx.Unlock()
+
+			time.Sleep(500 * time.Millisecond)
+			Expect(another.KeyNum()).To(Equal(0))
+			Expect(another.IndexNum()).To(Equal(0))
+		})
+
+		It("Given expirable values checked in small batches, when some of them expire, it should delete exactly the expired ones.", func() {
+			another := NewExpirableEMap(int(time.Hour/time.Millisecond), WithExpirationBatch(2))
+			defer another.Close()
+
+			values := make([]*expirebleStruct, 7)
+			for i := range values {
+				values[i] = &expirebleStruct{i%2 == 0, i}
+				err := another.Insert(i, values[i], "index")
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+
+			another.expire(&another.mtx)
+			Expect(another.KeyNum()).To(Equal(3))
+			Expect(another.expirables.keys).To(HaveLen(3))
+			for i := range values {
+				Expect(another.HasKey(i)).To(Equal(i%2 != 0))
+			}
+			Expect(another.check()).ShouldNot(HaveOccurred())
+		})
+
+		It("Given an expirable emap with lazy expiration, when values expire between checks, it should treat them as absent.", func() {
+			another := NewExpirableEMap(10000, WithLazyExpiration(false))
+			defer another.Close()
+
+			value := new(expirebleStruct)
+			another.InsertWithTTL("key1", "value1", 100*time.Millisecond, "index1", "index2")
+			another.Insert("key2", value, "index2")
+			another.InsertWithTTL("key3", "value3", time.Hour, "index2")
+
+			time.Sleep(200 * time.Millisecond)
+			another.mtx.Lock()
+			value.expired = true
+			another.mtx.Unlock()
+
+			_, err := another.FetchByKey("key1")
+			Expect(errors.Is(err, ErrKeyNotFound)).To(Equal(true))
+			_, err = another.FetchByKey("key2")
+			Expect(errors.Is(err, ErrKeyNotFound)).To(Equal(true))
+			_, err = another.FetchByIndex("index1")
+			Expect(errors.Is(err, ErrIndexNotFound)).To(Equal(true))
+			values, err := another.FetchByIndex("index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]interface{}{"value3"}))
+			Expect(another.HasKey("key1")).To(Equal(false))
+			Expect(another.HasIndex("index1")).To(Equal(false))
+			Expect(another.KeyNumOfIndex("index2")).To(Equal(1))
+			num := 0
+			another.Foreach(func(key interface{}, value interface{}) {
+				num++
+			})
+			Expect(num).To(Equal(1))
+			Expect(another.KeyNum()).To(Equal(3))
+		})
+
+		It("Given an expirable emap with lazy expiration and purge, when expired values are read, it should delete them on the spot.", func() {
+			another := NewExpirableEMap(10000, WithLazyExpiration(true))
+			defer another.Close()
+
+			var reasons []EvictReason
+			another.OnEvict(func(key interface{}, value interface{}, indices []interface{}, reason EvictReason) {
+				reasons = append(reasons, reason)
+			})
+			another.InsertWithTTL("key1", "value1", 100*time.Millisecond, "index1")
+			another.InsertWithTTL("key2", "value2", 100*time.Millisecond, "index1")
+
+			time.Sleep(200 * time.Millisecond)
+			Expect(another.KeyNum()).To(Equal(2))
+			Expect(another.HasIndex("index1")).To(Equal(false))
+			Expect(another.KeyNum()).To(Equal(0))
+			Expect(another.IndexNum()).To(Equal(0))
+			Expect(reasons).To(Equal([]EvictReason{EvictExpired, EvictExpired}))
+			Expect(another.check()).ShouldNot(HaveOccurred())
+		})
+
+		It("Given an expirable emap with sliding expiration, when values are accessed within the ttl, they should not expire.", func() {
+			another := NewExpirableEMap(50, WithTTL(300*time.Millisecond), WithSlidingExpiration())
+			defer another.Close()
+
+			another.Insert("key1", "value1", "index1")
+			another.Insert("key2", "value2", "index2")
+			another.Insert("key3", "value3", "index3")
+			for i := 0; i < 6; i++ {
+				time.Sleep(100 * time.Millisecond)
+				_, err := another.FetchByKey("key1")
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = another.FetchByIndex("index2")
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+			Expect(another.HasKey("key3")).To(Equal(false))
+			Expect(another.Touch("key3")).Should(HaveOccurred())
+
+			time.Sleep(200 * time.Millisecond)
+			Expect(another.Touch("key1")).ShouldNot(HaveOccurred())
+			time.Sleep(200 * time.Millisecond)
+			Expect(another.HasKey("key1")).To(Equal(true))
+			Expect(another.HasKey("key2")).To(Equal(false))
+			time.Sleep(300 * time.Millisecond)
+			Expect(another.KeyNum()).To(Equal(0))
+		})
+
+		It("Given an expirable emap, when it is closed, it should stop the expiration checker and reject further operations.", func() {
+			another := NewExpirableEMap(100)
+			err := another.Insert("key1", new(expirebleStruct), "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = another.Close()
+			Expect(err).ShouldNot(HaveOccurred())
+			Eventually(another.done).Should(BeClosed())
+
+			Expect(another.Close()).To(Equal(ErrClosed))
+			Expect(another.Insert("key2", new(expirebleStruct))).To(Equal(ErrClosed))
+			_, err = another.FetchByKey("key1")
+			Expect(err).To(Equal(ErrClosed))
+			_, err = another.FetchByIndex("index1")
+			Expect(err).To(Equal(ErrClosed))
+			Expect(another.DeleteByKey("key1")).To(Equal(ErrClosed))
+			Expect(another.AddIndex("key1", "index2")).To(Equal(ErrClosed))
+			Expect(another.KeyNum()).To(Equal(0))
+			Expect(another.HasKey("key1")).To(Equal(false))
+		})
+
+		It("Given an expirable emap with a context, when the context is cancelled, it should be closed.", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			another := NewExpirableEMapContext(ctx, 100)
+			err := another.Insert("key1", new(expirebleStruct))
+			Expect(err).ShouldNot(HaveOccurred())
+
+			cancel()
+			time.Sleep(200 * time.Millisecond)
+			Expect(another.Insert("key2", new(expirebleStruct))).To(Equal(ErrClosed))
+			Expect(another.Close()).To(Equal(ErrClosed))
+		})
+
+		It("Given an emap with a context but no expiration checker, when the context is cancelled, it should be closed.", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			generic := NewExpirableEMapContext(ctx, 0, WithLazyExpiration(true))
+			typed := NewTypedExpirableEMapContext[string, int, string](ctx, 0, WithLazyExpiration(true))
+			err := typed.InsertWithTTL("key1", 1, time.Hour)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			cancel()
+			Eventually(func() error { return generic.Insert("key1", "value1") }).Should(Equal(ErrClosed))
+			Eventually(func() error { return typed.Insert("key2", 2) }).Should(Equal(ErrClosed))
+		})
+
+		It("Given an emap with a context but no expiration checker, when it is closed, it should stop watching the context.", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			another := NewExpirableEMapContext(ctx, 0)
+			Expect(another.Close()).ShouldNot(HaveOccurred())
+			Expect(another.Close()).To(Equal(ErrClosed))
+		})
 	})
 
 	Context("strict emap", func() {
@@ -463,7 +689,7 @@ var _ = Describe("Tests of emap", func() {
 			data string
 		}
 
-		DescribeTable("Given an emap, when call Transform interface, it should return the trasformed values related to the callback.", func(emap EMap) {
+		DescribeTable("Given an emap, when call Transform interface, it should return the trasformed values related to the callback.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			emap.Insert("key1", 1, "index1")
 			emap.Insert("key2", 2, "index2")
 			emap.Insert("key3", 3, "index3")
@@ -484,7 +710,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap, when call Transform interface, it should fail when callback fails.", func(emap EMap) {
+		DescribeTable("Given an emap, when call Transform interface, it should fail when callback fails.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			emap.Insert("key1", 1, "index1")
 			emap.Insert("key2", 2, "index2")
 			emap.Insert("key3", 3, "index3")
@@ -506,7 +732,7 @@ var _ = Describe("Tests of emap", func() {
 			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		DescribeTable("Given an emap, when call Foreach interface, it should apply callback to each item.", func(emap EMap) {
+		DescribeTable("Given an emap, when call Foreach interface, it should apply callback to each item.", func(emap EMap[interface{}, interface{}, interface{}]) {
 			type testStruct struct {
 				num int
 			}
@@ -529,93 +755,1530 @@ var _ = Describe("Tests of emap", func() {
 		)
 	})
 
-	Context("benchmark emap", func() {
-		BeforeEach(func() {
-		})
+	Context("errors", func() {
+		DescribeTable("Given an emap, when an operation fails, it should return a sentinel error wrapped with the offending key or index.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			var keyErr *KeyError
+			var indexErr *IndexError
 
-		AfterEach(func() {
+			err := emap.Insert("key1", "value1", "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = emap.Insert("key1", "value2")
+			Expect(errors.Is(err, ErrKeyExists)).To(Equal(true))
+			Expect(errors.As(err, &keyErr)).To(Equal(true))
+			Expect(keyErr.Key).To(Equal("key1"))
+
+			_, err = emap.FetchByKey("key2")
+			Expect(errors.Is(err, ErrKeyNotFound)).To(Equal(true))
+			Expect(errors.As(err, &keyErr)).To(Equal(true))
+			Expect(keyErr.Key).To(Equal("key2"))
+
+			_, err = emap.FetchByIndex("index2")
+			Expect(errors.Is(err, ErrIndexNotFound)).To(Equal(true))
+			Expect(errors.As(err, &indexErr)).To(Equal(true))
+			Expect(indexErr.Index).To(Equal("index2"))
+
+			err = emap.AddIndex("key1", "index1")
+			Expect(errors.Is(err, ErrIndexExists)).To(Equal(true))
+			err = emap.RemoveIndex("key1", "index2")
+			Expect(errors.Is(err, ErrIndexNotFound)).To(Equal(true))
+			err = emap.DeleteByKey("key2")
+			Expect(errors.Is(err, ErrKeyNotFound)).To(Equal(true))
+			err = emap.DeleteByIndex("index2")
+			Expect(errors.Is(err, ErrIndexNotFound)).To(Equal(true))
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper("key", "value", "index")),
+			Entry("nolock emap test", NewUnlockEMap()),
+		)
+
+		It("Given a strict emap, when use different types, it should return ErrTypeMismatch.", func() {
+			var keyErr *KeyError
+			var valueErr *ValueError
+
+			emap, err := NewStrictEMap("key", "value", 123)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = emap.Insert(123, "value")
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+			Expect(errors.As(err, &keyErr)).To(Equal(true))
+			Expect(keyErr.Key).To(Equal(123))
+
+			err = emap.Insert("key", 123)
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+			Expect(errors.As(err, &valueErr)).To(Equal(true))
+			Expect(valueErr.Value).To(Equal(123))
+
+			_, err = emap.FetchByIndex("123")
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
 		})
+	})
 
-		Measure("Benchmark the goalng map performance", func(b Benchmarker) {
-			goMap := make(map[interface{}]interface{})
-			b.Time("GoMap", func() {
-				GoMapAdd(goMap, 200000)
-				GoMapGet(goMap, 200000)
-				GoMapDel(goMap, 200000)
+	Context("evict callback", func() {
+		type evicted struct {
+			key     interface{}
+			value   interface{}
+			indices []interface{}
+			reason  EvictReason
+		}
+
+		DescribeTable("Given an emap with an evict callback, when values are deleted, it should call back with the removed values outside the locker.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			var records []evicted
+			emap.(interface {
+				OnEvict(func(interface{}, interface{}, []interface{}, EvictReason))
+			}).OnEvict(func(key interface{}, value interface{}, indices []interface{}, reason EvictReason) {
+				Expect(emap.HasKey(key)).To(Equal(false))
+				records = append(records, evicted{key, value, indices, reason})
 			})
-		}, 10)
 
-		Measure("Benchmark the generic emap performance", func(b Benchmarker) {
-			eMap := NewGenericEMap()
-			EMapRuntime := b.Time("GenericEMap", func() {
-				EMapAdd(eMap, 200000)
-				EMapGet(eMap, 200000)
-				EMapDel(eMap, 200000)
+			emap.Insert("key1", "value1", "index1", "index2")
+			emap.Insert("key2", "value2", "index2")
+			emap.Insert("key3", "value3", "index3")
+
+			err := emap.DeleteByKey("key1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(records).To(Equal([]evicted{{"key1", "value1", []interface{}{"index1", "index2"}, EvictDeleted}}))
+
+			err = emap.DeleteByKey("key1")
+			Expect(err).Should(HaveOccurred())
+			Expect(records).To(HaveLen(1))
+
+			err = emap.DeleteByIndex("index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(records).To(HaveLen(2))
+			Expect(records[1]).To(Equal(evicted{"key2", "value2", []interface{}{"index2"}, EvictDeleted}))
+			Expect(emap.KeyNum()).To(Equal(1))
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper("key", "value", "index")),
+			Entry("nolock emap test", NewUnlockEMap()),
+		)
+
+		It("Given an expirable emap with an evict callback, when values expire, it should call back with reason expired.", func() {
+			emap := NewExpirableEMap(100, WithTTL(100*time.Millisecond))
+			defer emap.Close()
+
+			records := make(chan evicted, 2)
+			emap.OnEvict(func(key interface{}, value interface{}, indices []interface{}, reason EvictReason) {
+				emap.Insert(key.(string)+"-expired", value)
+				records <- evicted{key, value, indices, reason}
 			})
+			emap.InsertWithTTL("key1", "value1", 100*time.Millisecond, "index1")
 
-			Ω(EMapRuntime.Seconds()).Should(BeNumerically("<", 2), "Add/Get/Del 200000 values shouldn't take too long.")
-		}, 10)
+			Eventually(records).Should(Receive(Equal(evicted{"key1", "value1", []interface{}{"index1"}, EvictExpired})))
+			Expect(emap.HasKey("key1-expired")).To(Equal(true))
+			Expect(EvictExpired.String()).To(Equal("expired"))
+		})
+	})
 
-		Measure("Benchmark the stric emap performance", func(b Benchmarker) {
-			eMap, _ := NewStrictEMap("sample", &expirebleStruct{false, 0}, 123)
-			EMapRuntime := b.Time("StrictEMap", func() {
-				EMapAdd(eMap, 200000)
-				EMapGet(eMap, 200000)
-				EMapDel(eMap, 200000)
+	Context("capacity", func() {
+		DescribeTable("Given an emap with max entries, when it is full, it should evict the least recently used value with its indices.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			var victims []interface{}
+			emap.(interface {
+				OnEvict(func(interface{}, interface{}, []interface{}, EvictReason))
+			}).OnEvict(func(key interface{}, value interface{}, indices []interface{}, reason EvictReason) {
+				if reason == EvictCapacity {
+					victims = append(victims, key)
+				}
 			})
 
-			Ω(EMapRuntime.Seconds()).Should(BeNumerically("<", 2), "Add/Get/Del 200000 values shouldn't take too long.")
-		}, 10)
+			emap.Insert("key1", "value1", "index1")
+			emap.Insert("key2", "value2", "index1", "index2")
+			emap.Insert("key3", "value3", "index3")
+			_, err := emap.FetchByKey("key1")
+			Expect(err).ShouldNot(HaveOccurred())
 
-		Measure("Benchmark the nolock emap performance", func(b Benchmarker) {
-			eMap := NewUnlockEMap()
-			EMapRuntime := b.Time("NolockEMap", func() {
-				EMapAdd(eMap, 200000)
-				EMapGet(eMap, 200000)
-				EMapDel(eMap, 200000)
+			err = emap.Insert("key4", "value4", "index4")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(victims).To(Equal([]interface{}{"key2"}))
+			Expect(emap.KeyNum()).To(Equal(3))
+			Expect(emap.HasIndex("index2")).To(Equal(false))
+			Expect(emap.KeyNumOfIndex("index1")).To(Equal(1))
+
+			_, err = emap.FetchByIndex("index3")
+			Expect(err).ShouldNot(HaveOccurred())
+			emap.Insert("key5", "value5")
+			Expect(victims).To(Equal([]interface{}{"key2", "key1"}))
+			Expect(emap.HasIndex("index1")).To(Equal(false))
+
+			emap.DeleteByKey("key3")
+			Expect(emap.(evictCounter).EvictNum(EvictCapacity)).To(Equal(2))
+			Expect(emap.(evictCounter).EvictNum(EvictDeleted)).To(Equal(1))
+			Expect(EvictCapacity.String()).To(Equal("capacity"))
+		},
+			Entry("generic emap test", NewGenericEMap(WithMaxEntries(3))),
+			Entry("strict emap test", NewStrictEmapWrapper("key", "value", "index", WithMaxEntries(3))),
+			Entry("nolock emap test", NewUnlockEMap(WithMaxEntries(3))),
+		)
+
+		DescribeTable("Given an emap with a size budget, when it is exceeded, it should evict the least recently used values until the budget is met.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			sized := emap.(interface {
+				Size() int
 			})
+			emap.Insert("key1", "0123456789", "index1")
+			emap.Insert("key2", "01234567890123456789", "index1")
+			emap.Insert("key3", "0123456789", "index2")
+			Expect(sized.Size()).To(Equal(40))
+			emap.FetchByKey("key1")
 
-			Ω(EMapRuntime.Seconds()).Should(BeNumerically("<", 2), "Add/Get/Del 200000 values shouldn't take too long.")
-		}, 10)
+			err := emap.Insert("key4", "012345678901234567890123456789")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.HasKey("key2")).To(Equal(false))
+			Expect(emap.KeyNumOfIndex("index1")).To(Equal(1))
+			Expect(sized.Size()).To(Equal(50))
+			Expect(emap.(evictCounter).EvictNum(EvictSize)).To(Equal(1))
+
+			err = emap.Insert("key5", "01234567890123456789")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.HasKey("key3")).To(Equal(false))
+			Expect(emap.HasIndex("index2")).To(Equal(false))
+			Expect(emap.HasKey("key1")).To(Equal(false))
+			Expect(sized.Size()).To(Equal(50))
+			Expect(emap.(evictCounter).EvictNum(EvictSize)).To(Equal(3))
+
+			err = emap.Insert("key6", "0123456789012345678901234567890123456789012345678901234567890123456789")
+			Expect(errors.Is(err, ErrTooLarge)).To(Equal(true))
+			Expect(emap.KeyNum()).To(Equal(2))
+
+			emap.DeleteByKey("key4")
+			Expect(sized.Size()).To(Equal(20))
+			Expect(EvictSize.String()).To(Equal("size"))
+		},
+			Entry("generic emap test", NewGenericEMap(WithMaxSize(50, stringSizer))),
+			Entry("strict emap test", NewStrictEmapWrapper("key", "value", "index", WithMaxSize(50, stringSizer))),
+			Entry("nolock emap test", NewUnlockEMap(WithMaxSize(50, stringSizer))),
+		)
+
+		It("Given an expirable emap with a sizer, when values expire, it should release their size.", func() {
+			emap := NewExpirableEMap(100, WithTTL(100*time.Millisecond), WithMaxSize(100, stringSizer))
+			defer emap.Close()
+			emap.Insert("key1", "0123456789")
+			emap.InsertWithTTL("key2", "0123456789", time.Hour)
+			Expect(emap.Size()).To(Equal(20))
+
+			Eventually(emap.Size).Should(Equal(10))
+			Expect(emap.HasKey("key2")).To(Equal(true))
+		})
+
+		It("Given an emap with max entries and LFU policy, when it is full, it should evict the least frequently used value.", func() {
+			emap := NewTypedEMap[string, int, string](WithMaxEntries(2), WithEvictPolicy(LFU))
+			emap.Insert("key1", 1)
+			emap.Insert("key2", 2)
+			emap.FetchByKey("key1")
+			emap.FetchByKey("key1")
+			emap.FetchByKey("key2")
+
+			emap.Insert("key3", 3)
+			Expect(emap.HasKey("key2")).To(Equal(false))
+			Expect(emap.HasKey("key3")).To(Equal(true))
+
+			emap.Insert("key4", 4)
+			Expect(emap.HasKey("key1")).To(Equal(true))
+			Expect(emap.HasKey("key3")).To(Equal(false))
+			Expect(emap.EvictNum(EvictCapacity)).To(Equal(2))
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+		})
 	})
 
-	Context("debug", func() {
-		var (
-			emap *GenericEMap
+	Context("upsert and update", func() {
+		DescribeTable("Given an emap, when upsert and update values, it should replace the values in place, upsert replacing the indices and update keeping them.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			err := emap.Update("key1", "value1")
+			Expect(errors.Is(err, ErrKeyNotFound)).To(Equal(true))
+
+			err = emap.Upsert("key1", "value1", "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			err = emap.Upsert("key2", "value2", "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = emap.Upsert("key1", "value3", "index1", "index2", "index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			value, err := emap.FetchByKey("key1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(value).To(Equal("value3"))
+			Expect(emap.IndexNumOfKey("key1")).To(Equal(2))
+			Expect(emap.KeyNumOfIndex("index1")).To(Equal(2))
+			Expect(emap.KeyNumOfIndex("index2")).To(Equal(1))
+
+			err = emap.Update("key2", "value4")
+			Expect(err).ShouldNot(HaveOccurred())
+			values, err := emap.FetchByIndex("index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(ConsistOf("value3", "value4"))
+			Expect(emap.KeyNum()).To(Equal(2))
+
+			err = emap.Upsert("key1", "value5", "index2", "index3")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.IndexNumOfKey("key1")).To(Equal(2))
+			Expect(emap.KeyNumOfIndex("index1")).To(Equal(1))
+			Expect(emap.HasIndex("index3")).To(Equal(true))
+
+			err = emap.Upsert("key2", "value6")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.IndexNumOfKey("key2")).To(Equal(0))
+			Expect(emap.HasIndex("index1")).To(Equal(false))
+			Expect(emap.KeyNum()).To(Equal(2))
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper("key", "value", "index")),
+			Entry("nolock emap test", NewUnlockEMap()),
 		)
 
-		BeforeEach(func() {
-			emap = NewGenericEMap()
+		It("Given a strict emap, when upsert or update with a mismatched type, it should return an error.", func() {
+			emap, _ := NewStrictEMap("key", "value", "index")
+			emap.Insert("key1", "value1", "index1")
+
+			err := emap.Upsert("key1", 1)
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+			err = emap.Upsert("key1", "value2", 1)
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+			err = emap.Update(1, "value2")
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+
+			value, _ := emap.FetchByKey("key1")
+			Expect(value).To(Equal("value1"))
 		})
 
-		AfterEach(func() {
+		It("Given an emap with a size budget, when update a value, it should update the size and the evict policy.", func() {
+			emap := NewTypedEMap[string, string, string](WithMaxSize(30, func(key interface{}, value interface{}) int {
+				return len(value.(string))
+			}))
+			emap.Insert("key1", "0123456789")
+			emap.Insert("key2", "0123456789")
+			emap.Insert("key3", "0123456789")
+
+			err := emap.Update("key1", "01234567890123456789")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.HasKey("key1")).To(Equal(true))
+			Expect(emap.HasKey("key2")).To(Equal(false))
+			Expect(emap.Size()).To(Equal(30))
+
+			err = emap.Update("key3", "0123456789012345678901234567890123456789")
+			Expect(errors.Is(err, ErrTooLarge)).To(Equal(true))
+			Expect(emap.Size()).To(Equal(30))
 		})
+	})
 
-		It("Fix the unconsistency caused by deleteByKey", func() {
-			emap.Insert("key1", "value1", "index1", "index2", "index3")
-			emap.Insert("key2", "value2", "index1", "index2", "index3")
-			emap.Insert("key3", "value3", "index1", "index2", "index3")
-			Expect(emap.check()).ShouldNot(HaveOccurred())
+	Context("atomic read-modify-write", func() {
+		type atomicEMap interface {
+			EMap[interface{}, interface{}, interface{}]
+			Compute(key interface{}, callback func(old interface{}, exist bool) (interface{}, bool)) error
+			CompareAndSwap(key interface{}, old interface{}, value interface{}) (bool, error)
+			LoadOrStore(key interface{}, value interface{}, indices ...interface{}) (interface{}, bool, error)
+		}
 
-			emap.DeleteByKey("key1")
-			Expect(emap.check()).ShouldNot(HaveOccurred())
+		DescribeTable("Given an emap, when compute, compare and swap or load or store values, it should read and write them atomically.", func(emap atomicEMap) {
+			actual, loaded, err := emap.LoadOrStore("key1", 1, "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(loaded).To(Equal(false))
+			Expect(actual).To(Equal(1))
+			actual, loaded, err = emap.LoadOrStore("key1", 2, "index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(loaded).To(Equal(true))
+			Expect(actual).To(Equal(1))
+			Expect(emap.HasIndex("index2")).To(Equal(false))
+
+			err = emap.Compute("key1", func(old interface{}, exist bool) (interface{}, bool) {
+				Expect(exist).To(Equal(true))
+				return old.(int) + 10, true
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			values, _ := emap.FetchByIndex("index1")
+			Expect(values).To(Equal([]interface{}{11}))
+
+			swapped, err := emap.CompareAndSwap("key1", 1, 20)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(swapped).To(Equal(false))
+			swapped, err = emap.CompareAndSwap("key1", 11, 20)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(swapped).To(Equal(true))
+			value, _ := emap.FetchByKey("key1")
+			Expect(value).To(Equal(20))
+			_, err = emap.CompareAndSwap("key2", 1, 2)
+			Expect(errors.Is(err, ErrKeyNotFound)).To(Equal(true))
+
+			err = emap.Compute("key2", func(old interface{}, exist bool) (interface{}, bool) {
+				Expect(exist).To(Equal(false))
+				return 1, true
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.HasKey("key2")).To(Equal(true))
+			err = emap.Compute("key1", func(old interface{}, exist bool) (interface{}, bool) {
+				return nil, false
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.HasKey("key1")).To(Equal(false))
+			Expect(emap.HasIndex("index1")).To(Equal(false))
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper("key", 0, "index").(atomicEMap)),
+			Entry("nolock emap test", NewUnlockEMap()),
+		)
+
+		It("Given a generic emap, when values are computed concurrently, it should not lose any update.", func() {
+			emap := NewGenericEMap()
+			done := make(chan struct{})
+			for i := 0; i < 10; i++ {
+				go func() {
+					for j := 0; j < 100; j++ {
+						emap.Compute("counter", func(old interface{}, exist bool) (interface{}, bool) {
+							if !exist {
+								return 1, true
+							}
+							return old.(int) + 1, true
+						})
+					}
+					done <- struct{}{}
+				}()
+			}
+			for i := 0; i < 10; i++ {
+				<-done
+			}
+
+			value, err := emap.FetchByKey("counter")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(value).To(Equal(1000))
 		})
 
-		It("Fix the unconsistency caused by deleteByIndex", func() {
-			emap.Insert("key1", "value1", "index1", "index2", "index3")
-			emap.Insert("key2", "value2", "index1", "index2", "index3")
-			emap.Insert("key3", "value3", "index1", "index2", "index3")
-			Expect(emap.check()).ShouldNot(HaveOccurred())
+		It("Given a strict emap, when compute a value of a mismatched type, it should return an error and keep the value.", func() {
+			emap, _ := NewStrictEMap("key", 0, "index")
+			emap.Insert("key1", 1)
+			err := emap.Compute("key1", func(old interface{}, exist bool) (interface{}, bool) {
+				return "value", true
+			})
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+			value, _ := emap.FetchByKey("key1")
+			Expect(value).To(Equal(1))
+		})
 
-			emap.DeleteByIndex("index1")
-			Expect(emap.check()).ShouldNot(HaveOccurred())
+		It("Given a typed emap, when compare and swap uncomparable values, it should not swap nor panic.", func() {
+			emap := NewTypedEMap[string, []int, string]()
+			emap.Insert("key1", []int{1})
+			swapped, err := emap.CompareAndSwap("key1", []int{1}, []int{2})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(swapped).To(Equal(false))
+		})
+
+		It("Given a typed emap, when the callback of compute panics and the panic is recovered, it should release the locker.", func() {
+			emap := NewTypedEMap[string, int, string]()
+			emap.Insert("key1", 1)
+			Expect(func() {
+				emap.Compute("key1", func(value int, exist bool) (int, bool) {
+					panic("boom")
+				})
+			}).To(Panic())
+
+			done := make(chan struct{})
+			go func() {
+				emap.Insert("key2", 2)
+				close(done)
+			}()
+			Eventually(done).Should(BeClosed())
 		})
 	})
-})
 
-func NewStrictEmapWrapper(key interface{}, value interface{}, index interface{}) (emap EMap) {
-	emap, _ = NewStrictEMap(key, value, index)
-	return
+	Context("transaction", func() {
+		type txnEMap interface {
+			EMap[interface{}, interface{}, interface{}]
+			Txn(callback func(tx Tx[interface{}, interface{}, interface{}]) error) error
+		}
+
+		It("Given a typed emap, when the callback of a transaction panics and the panic is recovered, it should roll back and release the locker.", func() {
+			emap := NewTypedEMap[string, int, string]()
+			emap.Insert("key1", 1, "index1")
+			Expect(func() {
+				emap.Txn(func(tx Tx[string, int, string]) error {
+					tx.Insert("key2", 2, "index1")
+					tx.DeleteByKey("key1")
+					panic("boom")
+				})
+			}).To(Panic())
+
+			done := make(chan int)
+			go func() {
+				done <- emap.KeyNum()
+			}()
+			Eventually(done).Should(Receive(Equal(1)))
+			Expect(emap.HasKey("key1")).To(Equal(true))
+			Expect(emap.HasKey("key2")).To(Equal(false))
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+		})
+
+		DescribeTable("Given an emap, when a transaction succeeds, it should apply all the changes.", func(emap txnEMap) {
+			emap.Insert("key1", "value1", "index1")
+			err := emap.Txn(func(tx Tx[interface{}, interface{}, interface{}]) error {
+				if err := tx.Insert("key2", "value2", "index1"); err != nil {
+					return err
+				}
+				if err := tx.AddIndex("key2", "index2"); err != nil {
+					return err
+				}
+				if err := tx.AddIndex("key2", "index3"); err != nil {
+					return err
+				}
+				values, err := tx.FetchByIndex("index1")
+				Expect(values).To(Equal([]interface{}{"value1", "value2"}))
+				if err != nil {
+					return err
+				}
+				return tx.DeleteByKey("key1")
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.HasKey("key1")).To(Equal(false))
+			Expect(emap.IndexNumOfKey("key2")).To(Equal(3))
+			Expect(emap.KeyNumOfIndex("index1")).To(Equal(1))
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper("key", "value", "index").(txnEMap)),
+			Entry("nolock emap test", NewUnlockEMap()),
+		)
+
+		DescribeTable("Given an emap, when a transaction fails, it should roll back all the changes.", func(emap txnEMap) {
+			emap.Insert("key1", "value1", "index1", "index2")
+			emap.Insert("key2", "value2", "index1")
+			emap.Insert("key3", "value3", "index2")
+			var evicted []interface{}
+			emap.(interface {
+				OnEvict(func(interface{}, interface{}, []interface{}, EvictReason))
+			}).OnEvict(func(key interface{}, value interface{}, indices []interface{}, reason EvictReason) {
+				evicted = append(evicted, key)
+			})
+
+			err := emap.Txn(func(tx Tx[interface{}, interface{}, interface{}]) error {
+				Expect(tx.DeleteByKey("key1")).ShouldNot(HaveOccurred())
+				Expect(tx.Insert("key4", "value4", "index1", "index3")).ShouldNot(HaveOccurred())
+				Expect(tx.RemoveIndex("key3", "index2")).ShouldNot(HaveOccurred())
+				Expect(tx.AddIndex("key2", "index4")).ShouldNot(HaveOccurred())
+				return tx.Insert("key2", "value5")
+			})
+			Expect(errors.Is(err, ErrKeyExists)).To(Equal(true))
+			Expect(evicted).To(BeEmpty())
+
+			Expect(emap.KeyNum()).To(Equal(3))
+			Expect(emap.IndexNum()).To(Equal(2))
+			value, err := emap.FetchByKey("key1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(value).To(Equal("value1"))
+			values, err := emap.FetchByIndex("index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]interface{}{"value1", "value2"}))
+			values, err = emap.FetchByIndex("index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]interface{}{"value1", "value3"}))
+			Expect(emap.HasKey("key4")).To(Equal(false))
+			Expect(emap.HasIndex("index3")).To(Equal(false))
+			Expect(emap.HasIndex("index4")).To(Equal(false))
+			Expect(emap.(evictCounter).EvictNum(EvictDeleted)).To(Equal(0))
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper("key", "value", "index").(txnEMap)),
+			Entry("nolock emap test", NewUnlockEMap()),
+		)
+
+		It("Given a typed emap with ttl and capacity, when a transaction fails, it should restore the deadlines, sizes and evicted values.", func() {
+			emap := NewTypedEMap[string, string, string](WithTTL(time.Hour), WithMaxEntries(2), WithMaxSize(100, stringSizer))
+			emap.Insert("key1", "value1", "index1")
+			emap.Insert("key2", "value2")
+
+			err := emap.Txn(func(tx Tx[string, string, string]) error {
+				Expect(tx.DeleteByKey("key1")).ShouldNot(HaveOccurred())
+				Expect(tx.Insert("key3", "value3")).ShouldNot(HaveOccurred())
+				Expect(tx.Insert("key4", "value4")).ShouldNot(HaveOccurred())
+				return errors.New("abort")
+			})
+			Expect(err).To(MatchError("abort"))
+			Expect(emap.HasKey("key1")).To(Equal(true))
+			Expect(emap.HasKey("key2")).To(Equal(true))
+			Expect(emap.KeyNum()).To(Equal(2))
+			Expect(emap.Size()).To(Equal(12))
+			Expect(emap.schedules).To(HaveLen(2))
+			Expect(emap.deadlines).To(HaveKey("key1"))
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+
+			emap.Insert("key5", "value5")
+			Expect(emap.KeyNum()).To(Equal(2))
+			Expect(emap.HasKey("key5")).To(Equal(true))
+		})
+
+		It("Given a strict emap, when a transaction uses a mismatched type, it should return an error.", func() {
+			emap, _ := NewStrictEMap("key", "value", "index")
+			err := emap.Txn(func(tx Tx[interface{}, interface{}, interface{}]) error {
+				Expect(tx.Insert("key1", "value1")).ShouldNot(HaveOccurred())
+				return tx.AddIndex("key1", 1)
+			})
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+			Expect(emap.HasKey("key1")).To(Equal(false))
+		})
+	})
+
+	Context("snapshot", func() {
+		It("Given a generic emap, when take a snapshot, it should not be affected by the later changes.", func() {
+			emap := NewGenericEMap()
+			emap.Insert("key1", "value1", "index1", "index2")
+			emap.Insert("key2", "value2", "index1")
+
+			snapshot := emap.Snapshot()
+			Expect(emap.Snapshot()).To(BeIdenticalTo(snapshot))
+
+			emap.DeleteByKey("key1")
+			emap.RemoveIndex("key2", "index1")
+			emap.Insert("key3", "value3", "index1")
+			Expect(emap.Snapshot()).NotTo(BeIdenticalTo(snapshot))
+
+			Expect(snapshot.KeyNum()).To(Equal(2))
+			Expect(snapshot.IndexNum()).To(Equal(2))
+			Expect(snapshot.KeyNumOfIndex("index1")).To(Equal(2))
+			Expect(snapshot.IndexNumOfKey("key1")).To(Equal(2))
+			Expect(snapshot.HasKey("key3")).To(Equal(false))
+			Expect(snapshot.HasIndex("index2")).To(Equal(true))
+			value, err := snapshot.FetchByKey("key1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(value).To(Equal("value1"))
+			values, err := snapshot.FetchByIndex("index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]interface{}{"value1", "value2"}))
+			_, err = snapshot.FetchByKey("key3")
+			Expect(errors.Is(err, ErrKeyNotFound)).To(Equal(true))
+
+			snapshot.Foreach(func(key interface{}, value interface{}) {
+				Expect(emap.Insert(key.(string)+"-copy", value)).ShouldNot(HaveOccurred())
+			})
+			Expect(emap.KeyNum()).To(Equal(4))
+		})
+
+		It("Given a typed emap, when take a snapshot, it should share the storage until the next change.", func() {
+			emap := NewTypedEMap[string, string, string]()
+			emap.Insert("key1", "value1", "index1")
+
+			snapshot := emap.Snapshot()
+			Expect(emap.shared).To(Equal(true))
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+
+			emap.Update("key1", "value2")
+			Expect(emap.shared).To(Equal(false))
+			emap.AddIndex("key1", "index2")
+			value, _ := snapshot.FetchByKey("key1")
+			Expect(value).To(Equal("value1"))
+			Expect(snapshot.IndexNumOfKey("key1")).To(Equal(1))
+			Expect(snapshot.HasIndex("index2")).To(Equal(false))
+			Expect(emap.IndexNumOfKey("key1")).To(Equal(2))
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+		})
+
+		It("Given an unlock emap, when a transaction fails, it should keep the cached snapshot valid.", func() {
+			emap := NewUnlockEMap()
+			emap.Insert("key1", "value1", "index1")
+			snapshot := emap.Snapshot()
+
+			emap.Txn(func(tx Tx[interface{}, interface{}, interface{}]) error {
+				tx.DeleteByKey("key1")
+				return errors.New("abort")
+			})
+			Expect(emap.Snapshot().KeyNum()).To(Equal(1))
+			Expect(snapshot.KeyNum()).To(Equal(1))
+		})
+
+		It("Given a typed emap with lazy expiration, when take a snapshot, it should leave out the expired values.", func() {
+			emap := NewTypedExpirableEMap[string, *expirebleStruct, string](0, WithLazyExpiration(false))
+			defer emap.Close()
+			expired := &expirebleStruct{expired: true}
+			emap.Insert("key1", expired, "index1")
+			emap.Insert("key2", new(expirebleStruct), "index1")
+
+			snapshot := emap.Snapshot()
+			Expect(snapshot.KeyNum()).To(Equal(1))
+			Expect(snapshot.HasKey("key1")).To(Equal(false))
+			Expect(snapshot.KeyNumOfIndex("index1")).To(Equal(1))
+			Expect(emap.KeyNum()).To(Equal(2))
+		})
+	})
+
+	Context("index family", func() {
+		type familyEMap interface {
+			EMap[interface{}, interface{}, interface{}]
+			Index(name string) *IndexFamily[interface{}, interface{}, interface{}]
+		}
+
+		DescribeTable("Given an emap with index families, when the same index is used in different families, it should not collide.", func(emap familyEMap) {
+			emap.Insert("key1", "value1", "1")
+			emap.Insert("key2", "value2")
+			emap.Insert("key3", "value3")
+			users, groups := emap.Index("user"), emap.Index("group")
+
+			Expect(users.AddIndex("key1", "1")).ShouldNot(HaveOccurred())
+			Expect(users.AddIndex("key2", "2")).ShouldNot(HaveOccurred())
+			Expect(groups.AddIndex("key2", "1")).ShouldNot(HaveOccurred())
+			Expect(groups.AddIndex("key3", "1")).ShouldNot(HaveOccurred())
+			err := groups.AddIndex("key3", "1")
+			Expect(errors.Is(err, ErrIndexExists)).To(Equal(true))
+			err = groups.AddIndex("key4", "1")
+			Expect(errors.Is(err, ErrKeyNotFound)).To(Equal(true))
+
+			values, err := users.FetchByIndex("1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]interface{}{"value1"}))
+			values, err = groups.FetchByIndex("1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]interface{}{"value2", "value3"}))
+			values, err = emap.FetchByIndex("1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]interface{}{"value1"}))
+			_, err = emap.Index("other").FetchByIndex("1")
+			Expect(errors.Is(err, ErrIndexNotFound)).To(Equal(true))
+			Expect(users.IndexNum()).To(Equal(2))
+			Expect(groups.KeyNumOfIndex("1")).To(Equal(2))
+
+			Expect(groups.RemoveIndex("key3", "1")).ShouldNot(HaveOccurred())
+			Expect(groups.KeyNumOfIndex("1")).To(Equal(1))
+			err = groups.RemoveIndex("key3", "1")
+			Expect(errors.Is(err, ErrIndexNotFound)).To(Equal(true))
+
+			Expect(groups.DeleteByIndex("1")).ShouldNot(HaveOccurred())
+			Expect(emap.HasKey("key2")).To(Equal(false))
+			Expect(users.HasIndex("2")).To(Equal(false))
+			Expect(users.HasIndex("1")).To(Equal(true))
+
+			emap.DeleteByKey("key1")
+			Expect(users.IndexNum()).To(Equal(0))
+			Expect(emap.KeyNum()).To(Equal(1))
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper("key", "value", "index").(familyEMap)),
+			Entry("nolock emap test", NewUnlockEMap()),
+		)
+
+		It("Given a typed emap with an index family, when a transaction fails, it should restore the indices of the family.", func() {
+			emap := NewTypedEMap[string, string, int]()
+			emap.Insert("key1", "value1")
+			emap.Insert("key2", "value2")
+			emap.Index("user").AddIndex("key1", 1)
+			emap.Index("user").AddIndex("key2", 1)
+
+			err := emap.Txn(func(tx Tx[string, string, int]) error {
+				tx.DeleteByKey("key1")
+				return errors.New("abort")
+			})
+			Expect(err).Should(HaveOccurred())
+			values, err := emap.Index("user").FetchByIndex(1)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]string{"value1", "value2"}))
+		})
+
+		It("Given a strict emap, when use an index of a mismatched type in a family, it should return an error.", func() {
+			emap, _ := NewStrictEMap("key", "value", "index")
+			emap.Insert("key1", "value1")
+			err := emap.Index("user").AddIndex("key1", 1)
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+			_, err = emap.Index("user").FetchByIndex(1)
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+		})
+
+		It("Given a closed expirable emap, when use an index family, it should return ErrClosed.", func() {
+			emap := NewExpirableEMap(100)
+			emap.Close()
+			err := emap.Index("user").AddIndex("key1", 1)
+			Expect(err).To(Equal(ErrClosed))
+		})
+	})
+
+	Context("index extractor", func() {
+		type user struct {
+			Name   string
+			Groups []string
+		}
+		byGroups := func(value interface{}) []interface{} {
+			var indices []interface{}
+			for _, group := range value.(user).Groups {
+				indices = append(indices, group)
+			}
+			return indices
+		}
+		byName := func(value interface{}) []interface{} {
+			return []interface{}{value.(user).Name}
+		}
+
+		DescribeTable("Given an emap with index extractors, when insert and update values, it should derive the indices from the values.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			err := emap.Insert("key1", user{"alice", []string{"admin", "dev"}}, "manual")
+			Expect(err).ShouldNot(HaveOccurred())
+			err = emap.Insert("key2", user{"bob", []string{"dev"}})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.IndexNumOfKey("key1")).To(Equal(4))
+			Expect(emap.KeyNumOfIndex("dev")).To(Equal(2))
+			Expect(emap.HasIndex("alice")).To(Equal(true))
+
+			err = emap.Update("key1", user{"alice", []string{"dev", "ops"}})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.HasIndex("admin")).To(Equal(false))
+			Expect(emap.HasIndex("ops")).To(Equal(true))
+			Expect(emap.HasIndex("manual")).To(Equal(true))
+			values, err := emap.FetchByIndex("dev")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(HaveLen(2))
+			Expect(emap.IndexNumOfKey("key1")).To(Equal(4))
+
+			err = emap.Upsert("key2", user{"carol", nil}, "manual")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.HasIndex("bob")).To(Equal(false))
+			Expect(emap.KeyNumOfIndex("dev")).To(Equal(1))
+			Expect(emap.KeyNumOfIndex("manual")).To(Equal(2))
+			Expect(emap.IndexNumOfKey("key2")).To(Equal(2))
+			err = emap.Upsert("key2", user{"carol", nil})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.KeyNumOfIndex("manual")).To(Equal(1))
+			Expect(emap.IndexNumOfKey("key2")).To(Equal(1))
+			Expect(emap.HasIndex("carol")).To(Equal(true))
+
+			emap.DeleteByIndex("carol")
+			Expect(emap.KeyNum()).To(Equal(1))
+			Expect(emap.KeyNumOfIndex("manual")).To(Equal(1))
+		},
+			Entry("generic emap test", NewGenericEMap(WithIndexExtractor(byGroups), WithIndexExtractor(byName))),
+			Entry("strict emap test", NewStrictEmapWrapper("key", user{}, "index", WithIndexExtractor(byGroups), WithIndexExtractor(byName))),
+			Entry("nolock emap test", NewUnlockEMap(WithIndexExtractor(byGroups), WithIndexExtractor(byName))),
+		)
+
+		It("Given a typed emap with an index extractor of a mismatched type, when insert a value, it should return an error.", func() {
+			emap := NewTypedEMap[string, user, int](WithIndexExtractor(byName))
+			err := emap.Insert("key1", user{Name: "alice"})
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+			Expect(emap.HasKey("key1")).To(Equal(false))
+		})
+
+		It("Given a typed emap with an index extractor, when a transaction fails, it should restore the derived indices.", func() {
+			emap := NewTypedEMap[string, user, string](WithIndexExtractor(byGroups))
+			emap.Insert("key1", user{"alice", []string{"admin"}})
+			emap.Txn(func(tx Tx[string, user, string]) error {
+				tx.DeleteByKey("key1")
+				tx.Insert("key1", user{"alice", []string{"dev"}})
+				return errors.New("abort")
+			})
+			Expect(emap.HasIndex("admin")).To(Equal(true))
+			Expect(emap.HasIndex("dev")).To(Equal(false))
+
+			emap.Update("key1", user{"alice", nil})
+			Expect(emap.IndexNum()).To(Equal(0))
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("unique index", func() {
+		DescribeTable("Given an emap with unique indices, when a second key takes an index, it should return a constraint error.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			err := emap.Insert("key1", 1, "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			err = emap.Insert("key2", 2, "index1")
+			Expect(errors.Is(err, ErrUniqueViolation)).To(Equal(true))
+			var constraint *ConstraintError
+			Expect(errors.As(err, &constraint)).To(Equal(true))
+			Expect(constraint.Index).To(Equal("index1"))
+			Expect(constraint.Key).To(Equal("key1"))
+			Expect(emap.HasKey("key2")).To(Equal(false))
+
+			err = emap.Insert("key2", 2, "index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			err = emap.AddIndex("key2", "index1")
+			Expect(errors.Is(err, ErrUniqueViolation)).To(Equal(true))
+			err = emap.Upsert("key2", 3, "index1")
+			Expect(errors.Is(err, ErrUniqueViolation)).To(Equal(true))
+			value, err := emap.FetchByKey("key2")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(value).To(Equal(2))
+			err = emap.Upsert("key1", 4, "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			value, err = emap.FetchOneByIndex("index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(value).To(Equal(4))
+			_, err = emap.FetchOneByIndex("index3")
+			Expect(errors.Is(err, ErrIndexNotFound)).To(Equal(true))
+
+			emap.DeleteByKey("key1")
+			err = emap.AddIndex("key2", "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+		},
+			Entry("generic emap test", NewGenericEMap(WithUniqueIndex(""))),
+			Entry("strict emap test", NewStrictEmapWrapper("key", 1, "index", WithUniqueIndex(""))),
+			Entry("nolock emap test", NewUnlockEMap(WithUniqueIndex(""))),
+		)
+
+		It("Given a typed emap with a unique index family, when a second key takes an index of the family, it should return a constraint error.", func() {
+			emap := NewTypedEMap[string, int, string](WithUniqueIndex("email"))
+			emap.Insert("key1", 1, "shared")
+			emap.Insert("key2", 2, "shared")
+			emails := emap.Index("email")
+			err := emails.AddIndex("key1", "alice@example.com")
+			Expect(err).ShouldNot(HaveOccurred())
+			err = emails.AddIndex("key2", "alice@example.com")
+			Expect(errors.Is(err, ErrUniqueViolation)).To(Equal(true))
+			var constraint *ConstraintError
+			Expect(errors.As(err, &constraint)).To(Equal(true))
+			Expect(constraint.Family).To(Equal("email"))
+
+			value, err := emails.FetchOneByIndex("alice@example.com")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(value).To(Equal(1))
+			value, err = emap.FetchOneByIndex("shared")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(value).To(Equal(1))
+
+			err = emap.Index("").AddIndex("key1", "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.HasIndex("index1")).To(Equal(true))
+		})
+
+		It("Given a typed emap with a unique index and an index extractor, when a derived index is taken, it should return a constraint error.", func() {
+			emap := NewTypedEMap[string, string, string](WithUniqueIndex(""), WithIndexExtractor(func(value interface{}) []interface{} {
+				return []interface{}{value}
+			}))
+			emap.Insert("key1", "alice")
+			emap.Insert("key2", "bob")
+			err := emap.Update("key2", "alice")
+			Expect(errors.Is(err, ErrUniqueViolation)).To(Equal(true))
+			value, _ := emap.FetchByKey("key2")
+			Expect(value).To(Equal("bob"))
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("ordered index", func() {
+		byInt := func(a, b interface{}) int {
+			return a.(int) - b.(int)
+		}
+
+		DescribeTable("Given an emap with ordered indices, when fetch by index range, it should return the values in the order of the indices.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			ordered := emap.(interface {
+				FetchByIndexRange(lo, hi interface{}) ([]interface{}, error)
+				Min() (interface{}, []interface{}, error)
+				Max() (interface{}, []interface{}, error)
+				Ascend(callback func(interface{}, interface{}) bool) error
+				Descend(callback func(interface{}, interface{}) bool) error
+			})
+
+			_, _, err := ordered.Min()
+			Expect(errors.Is(err, ErrIndexNotFound)).To(Equal(true))
+			emap.Insert("key30", "value30", 30)
+			emap.Insert("key10", "value10", 10)
+			emap.Insert("key20", "value20", 20, 25)
+			emap.Insert("key40", "value40", 40)
+
+			values, err := ordered.FetchByIndexRange(15, 30)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]interface{}{"value20", "value30"}))
+			values, err = ordered.FetchByIndexRange(31, 39)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(BeEmpty())
+			values, err = emap.FetchByIndex(25)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]interface{}{"value20"}))
+
+			index, values, err := ordered.Min()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(index).To(Equal(10))
+			Expect(values).To(Equal([]interface{}{"value10"}))
+			index, _, err = ordered.Max()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(index).To(Equal(40))
+
+			emap.DeleteByKey("key10")
+			emap.RemoveIndex("key40", 40)
+			emap.AddIndex("key40", 5)
+			var indices []interface{}
+			ordered.Ascend(func(index interface{}, value interface{}) bool {
+				indices = append(indices, index)
+				return true
+			})
+			Expect(indices).To(Equal([]interface{}{5, 20, 25, 30}))
+			indices = nil
+			ordered.Descend(func(index interface{}, value interface{}) bool {
+				indices = append(indices, index)
+				return len(indices) < 2
+			})
+			Expect(indices).To(Equal([]interface{}{30, 25}))
+		},
+			Entry("generic emap test", NewGenericEMap(WithOrderedIndex(byInt))),
+			Entry("strict emap test", NewStrictEmapWrapper("key", "value", 1, WithOrderedIndex(byInt))),
+			Entry("nolock emap test", NewUnlockEMap(WithOrderedIndex(byInt))),
+		)
+
+		It("Given an emap without ordered indices, when fetch by index range, it should return an error.", func() {
+			emap := NewGenericEMap()
+			emap.Insert("key1", "value1", 1)
+			_, err := emap.FetchByIndexRange(0, 2)
+			Expect(err).To(Equal(ErrUnordered))
+			err = emap.Ascend(func(index interface{}, value interface{}) bool { return true })
+			Expect(err).To(Equal(ErrUnordered))
+		})
+
+		It("Given a typed emap with ordered indices, when a transaction fails, it should restore the order of the indices.", func() {
+			emap := NewTypedEMap[string, int, int](WithOrderedIndex(byInt))
+			emap.Insert("key1", 1, 1)
+			emap.Insert("key2", 2, 2)
+			emap.Txn(func(tx Tx[string, int, int]) error {
+				tx.DeleteByKey("key1")
+				tx.Insert("key0", 0, 0)
+				return errors.New("abort")
+			})
+
+			index, values, err := emap.Min()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(index).To(Equal(1))
+			Expect(values).To(Equal([]int{1}))
+			values, err = emap.FetchByIndexRange(-1, 1)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]int{1}))
+		})
+
+		It("Given a typed emap with ordered indices, when add and remove random indices, it should keep the indices sorted.", func() {
+			emap := NewTypedUnlockEMap[int, int, int](WithOrderedIndex(byInt))
+			for i := 0; i < 1000; i++ {
+				emap.Insert(i, i, rand.Intn(500), rand.Intn(500))
+			}
+			for i := 0; i < 1000; i += 3 {
+				emap.DeleteByKey(i)
+			}
+
+			var expected []int
+			emap.Foreach(func(key int, value int) {
+				for _, index := range emap.keys[key] {
+					if !contains(expected, index) {
+						expected = append(expected, index)
+					}
+				}
+			})
+			sort.Ints(expected)
+			var indices []int
+			emap.Ascend(func(index int, value int) bool {
+				if len(indices) == 0 || indices[len(indices)-1] != index {
+					indices = append(indices, index)
+				}
+				return true
+			})
+			Expect(indices).To(Equal(expected))
+			index, _, _ := emap.Max()
+			Expect(index).To(Equal(expected[len(expected)-1]))
+		})
+	})
+
+	Context("set queries", func() {
+		DescribeTable("Given an emap with overlapping indices, when query across indices, it should return the matched keys and values.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			sets := emap.(interface {
+				FetchByAllIndices(indices ...interface{}) ([]KeyValue[interface{}, interface{}], error)
+				FetchByAnyIndex(indices ...interface{}) ([]KeyValue[interface{}, interface{}], error)
+				FetchExcept(index interface{}, excluded ...interface{}) ([]KeyValue[interface{}, interface{}], error)
+			})
+			emap.Insert("key1", "value1", "a", "b")
+			emap.Insert("key2", "value2", "a")
+			emap.Insert("key3", "value3", "a", "b", "c")
+			emap.Insert("key4", "value4", "c")
+
+			pairs, err := sets.FetchByAllIndices("a", "b")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(Equal([]KeyValue[interface{}, interface{}]{{"key1", "value1"}, {"key3", "value3"}}))
+			pairs, err = sets.FetchByAllIndices("b", "c", "d")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(BeEmpty())
+
+			pairs, err = sets.FetchByAnyIndex("b", "c")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(Equal([]KeyValue[interface{}, interface{}]{{"key1", "value1"}, {"key3", "value3"}, {"key4", "value4"}}))
+
+			pairs, err = sets.FetchExcept("a", "b")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(Equal([]KeyValue[interface{}, interface{}]{{"key2", "value2"}}))
+			pairs, err = sets.FetchExcept("a")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(HaveLen(3))
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper("key", "value", "index")),
+			Entry("nolock emap test", NewUnlockEMap()),
+		)
+
+		It("Given a strict emap, when query across indices of a wrong type, it should return an error.", func() {
+			emap, _ := NewStrictEMap("key", "value", "index")
+			_, err := emap.FetchByAllIndices("a", 1)
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+			_, err = emap.FetchExcept(1, "a")
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+		})
+
+		It("Given a typed emap with lazy expiration, when query across indices, it should leave out the expired values.", func() {
+			emap := NewTypedEMap[string, int, string](WithLazyExpiration(false))
+			emap.InsertWithTTL("key1", 1, 50*time.Millisecond, "a", "b")
+			emap.Insert("key2", 2, "a", "b")
+			time.Sleep(100 * time.Millisecond)
+
+			pairs, err := emap.FetchByAllIndices("a", "b")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(Equal([]KeyValue[string, int]{{"key2", 2}}))
+		})
+	})
+
+	Context("query", func() {
+		DescribeTable("Given an emap with indices in families, when run a query, it should return the key-value pairs matching all the conditions.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			queryable := emap.(interface {
+				Query() *Query
+				Index(name string) *IndexFamily[interface{}, interface{}, interface{}]
+			})
+			for i := 1; i <= 6; i++ {
+				region := "eu"
+				if i%2 == 0 {
+					region = "us"
+				}
+				emap.Insert(i, i*10, region)
+			}
+			tiers := queryable.Index("tier")
+			tiers.AddIndex(1, "gold")
+			tiers.AddIndex(3, "gold")
+			tiers.AddIndex(4, "gold")
+			tiers.AddIndex(5, "silver")
+
+			pairs, err := queryable.Query().Where(Index("", "eu")).And(Index("tier", "gold")).Fetch()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(Equal([]KeyValue[interface{}, interface{}]{{1, 10}, {3, 30}}))
+
+			pairs, err = queryable.Query().Where(Index("", "eu")).Filter(func(key interface{}, value interface{}) bool {
+				return value.(int) > 10
+			}).Limit(1).Fetch()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(Equal([]KeyValue[interface{}, interface{}]{{3, 30}}))
+
+			pairs, err = queryable.Query().Where(AnyOf(Index("tier", "silver"), Keys(2, 2, 7))).And(NoneOf(Index("", "us"))).Fetch()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(Equal([]KeyValue[interface{}, interface{}]{{5, 50}}))
+
+			pairs, err = queryable.Query().Where(NoneOf(Index("tier", "gold"), Index("tier", "silver"))).Fetch()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(ConsistOf(KeyValue[interface{}, interface{}]{2, 20}, KeyValue[interface{}, interface{}]{6, 60}))
+
+			pairs, err = queryable.Query().Where(Index("", "asia")).Fetch()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(BeEmpty())
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper(1, 1, "index")),
+			Entry("nolock emap test", NewUnlockEMap()),
+		)
+
+		It("Given a strict emap, when run a query with a condition of a wrong type, it should return an error.", func() {
+			emap, _ := NewStrictEMap(1, 1, "index")
+			emap.Insert(1, 10, "eu")
+			_, err := emap.Query().Where(AnyOf(Index("", 1))).Fetch()
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+			_, err = emap.Query().Where(Keys("key")).Fetch()
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+		})
+
+		It("Given a closed emap, when run a query, it should return an error.", func() {
+			emap := NewExpirableEMap(10000)
+			emap.Close()
+			_, err := emap.Query().Where(Keys(1)).Fetch()
+			Expect(err).To(Equal(ErrClosed))
+		})
+	})
+
+	Context("fetch keys", func() {
+		DescribeTable("Given an emap with indices, when fetch keys and indices, it should tell which key each value belongs to.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			emap.Insert("key1", "value1", "index1", "index2")
+			emap.Insert("key2", "value2", "index2")
+
+			keys, err := emap.FetchKeysByIndex("index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(keys).To(Equal([]interface{}{"key1", "key2"}))
+			pairs, err := emap.FetchEntriesByIndex("index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(Equal([]KeyValue[interface{}, interface{}]{{"key1", "value1"}, {"key2", "value2"}}))
+			indices, err := emap.FetchIndicesByKey("key1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(indices).To(Equal([]interface{}{"index1", "index2"}))
+
+			indices[0] = "index3"
+			Expect(emap.HasIndex("index1")).To(Equal(true))
+			_, err = emap.FetchKeysByIndex("index3")
+			Expect(errors.Is(err, ErrIndexNotFound)).To(Equal(true))
+			_, err = emap.FetchEntriesByIndex("index3")
+			Expect(errors.Is(err, ErrIndexNotFound)).To(Equal(true))
+			_, err = emap.FetchIndicesByKey("key3")
+			Expect(errors.Is(err, ErrKeyNotFound)).To(Equal(true))
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper("key", "value", "index")),
+			Entry("nolock emap test", NewUnlockEMap()),
+		)
+
+		It("Given a typed emap with lazy expiration, when fetch keys by index, it should leave out the expired keys.", func() {
+			emap := NewTypedEMap[string, int, string](WithLazyExpiration(false))
+			emap.InsertWithTTL("key1", 1, 50*time.Millisecond, "index1")
+			emap.Insert("key2", 2, "index1")
+			time.Sleep(100 * time.Millisecond)
+
+			keys, err := emap.FetchKeysByIndex("index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(keys).To(Equal([]string{"key2"}))
+			_, err = emap.FetchIndicesByKey("key1")
+			Expect(errors.Is(err, ErrKeyNotFound)).To(Equal(true))
+		})
+	})
+
+	Context("scan", func() {
+		DescribeTable("Given an emap changed between the pages of a scan, when scan with cursors, it should return each surviving value exactly once.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			scanner := emap.(interface {
+				Scan(cursor uint64, count int) ([]KeyValue[interface{}, interface{}], uint64, error)
+				ScanIndex(index interface{}, cursor uint64, count int) ([]KeyValue[interface{}, interface{}], uint64, error)
+			})
+			for i := 0; i < 25; i++ {
+				emap.Insert(i, i, i%2)
+			}
+
+			seen := make(map[interface{}]int)
+			var cursor uint64
+			for page := 0; ; page++ {
+				pairs, next, err := scanner.Scan(cursor, 10)
+				Expect(err).ShouldNot(HaveOccurred())
+				for _, pair := range pairs {
+					seen[pair.Key]++
+				}
+				if next == 0 {
+					break
+				}
+				cursor = next
+				if page == 0 {
+					emap.DeleteByKey(15)
+					emap.Update(20, 200)
+					emap.Insert(100, 100, 0)
+				}
+			}
+			Expect(seen).To(HaveLen(25))
+			for key, num := range seen {
+				Expect(num).To(Equal(1))
+				Expect(key).NotTo(Equal(15))
+			}
+
+			pairs, next, err := scanner.ScanIndex(1, 0, 5)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(HaveLen(5))
+			Expect(pairs[0]).To(Equal(KeyValue[interface{}, interface{}]{1, 1}))
+			emap.RemoveIndex(3, 1)
+			pairs, next, err = scanner.ScanIndex(1, next, 10)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(HaveLen(6))
+			Expect(pairs[0]).To(Equal(KeyValue[interface{}, interface{}]{11, 11}))
+			Expect(next).To(BeZero())
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper(1, 1, 1)),
+			Entry("nolock emap test", NewUnlockEMap()),
+		)
+
+		It("Given a typed emap with most keys deleted during a scan, when continue the scan, it should keep the cursor valid.", func() {
+			emap := NewTypedUnlockEMap[int, int, int]()
+			for i := 0; i < 1000; i++ {
+				emap.Insert(i, i)
+			}
+			pairs, cursor, _ := emap.Scan(0, 100)
+			Expect(pairs[99].Key).To(Equal(99))
+			for i := 0; i < 900; i++ {
+				emap.DeleteByKey(i)
+			}
+			Expect(len(emap.scanLog)).To(BeNumerically("<", 1000))
+
+			pairs, cursor, _ = emap.Scan(cursor, 1000)
+			Expect(pairs).To(HaveLen(100))
+			Expect(pairs[0].Key).To(Equal(900))
+			Expect(cursor).To(BeZero())
+		})
+
+		It("Given a typed emap, when a transaction deleting a key fails, it should keep the key in its place of the scan.", func() {
+			emap := NewTypedEMap[string, int, string]()
+			emap.Insert("key1", 1)
+			emap.Insert("key2", 2)
+			emap.Txn(func(tx Tx[string, int, string]) error {
+				tx.DeleteByKey("key1")
+				tx.Insert("key1", 10)
+				return errors.New("abort")
+			})
+
+			pairs, _, err := emap.Scan(0, 10)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(pairs).To(Equal([]KeyValue[string, int]{{"key1", 1}, {"key2", 2}}))
+		})
+	})
+
+	Context("foreach variants", func() {
+		It("Given a generic emap, when the callback of foreach panics and the panic is recovered, it should release the locker.", func() {
+			emap := NewGenericEMap()
+			emap.Insert("key1", 1)
+			Expect(func() {
+				emap.Foreach(func(key interface{}, value interface{}) {
+					panic("boom")
+				})
+			}).To(Panic())
+
+			done := make(chan struct{})
+			go func() {
+				emap.Insert("key2", 2)
+				close(done)
+			}()
+			Eventually(done).Should(BeClosed())
+		})
+
+		DescribeTable("Given an emap, when apply the foreach variants, it should stop early or walk only the index.", func(emap EMap[interface{}, interface{}, interface{}]) {
+			for i := 0; i < 10; i++ {
+				emap.Insert(i, i*10, i%3)
+			}
+
+			num := 0
+			emap.ForeachUntil(func(key interface{}, value interface{}) bool {
+				num++
+				return num < 4
+			})
+			Expect(num).To(Equal(4))
+
+			num = 0
+			err := emap.ForeachErr(func(key interface{}, value interface{}) error {
+				num++
+				if num == 2 {
+					return errors.New("stop")
+				}
+				return nil
+			})
+			Expect(err).To(MatchError("stop"))
+			Expect(num).To(Equal(2))
+			err = emap.ForeachErr(func(key interface{}, value interface{}) error {
+				return nil
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			var keys []interface{}
+			emap.ForeachByIndex(0, func(key interface{}, value interface{}) {
+				Expect(value).To(Equal(key.(int) * 10))
+				keys = append(keys, key)
+			})
+			Expect(keys).To(Equal([]interface{}{0, 3, 6, 9}))
+			emap.ForeachByIndex(5, func(key interface{}, value interface{}) {
+				Fail("non-existed index walked")
+			})
+		},
+			Entry("generic emap test", NewGenericEMap()),
+			Entry("strict emap test", NewStrictEmapWrapper(1, 1, 1)),
+			Entry("nolock emap test", NewUnlockEMap()),
+		)
+
+		It("Given a closed emap, when apply ForeachErr, it should return ErrClosed.", func() {
+			generic := NewExpirableEMap(0)
+			generic.Insert("key1", "value1")
+			generic.Close()
+			err := generic.ForeachErr(func(key interface{}, value interface{}) error {
+				return nil
+			})
+			Expect(err).To(Equal(ErrClosed))
+
+			typed := NewTypedExpirableEMap[string, int, string](0)
+			typed.Close()
+			err = typed.ForeachErr(func(key string, value int) error {
+				return nil
+			})
+			Expect(err).To(Equal(ErrClosed))
+		})
+
+		It("Given an unlock emap, when the callback of ForeachByIndex removes the index, it should still walk each key once.", func() {
+			emap := NewTypedUnlockEMap[int, int, string]()
+			for i := 0; i < 5; i++ {
+				emap.Insert(i, i, "index")
+			}
+
+			num := 0
+			emap.ForeachByIndex("index", func(key int, value int) {
+				emap.RemoveIndex(key, "index")
+				num++
+			})
+			Expect(num).To(Equal(5))
+			Expect(emap.HasIndex("index")).To(Equal(false))
+		})
+	})
+
+	Context("typed emap", func() {
+		It("Given a typed emap, when add a new item, it should be able to get the typed value by key or index later.", func() {
+			emap := NewTypedEMap[string, int, string]()
+			err := emap.Insert("key1", 1, "index1", "index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			err = emap.Insert("key2", 2, "index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			err = emap.Insert("key1", 3)
+			Expect(err).Should(HaveOccurred())
+
+			value, err := emap.FetchByKey("key1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(value + 10).To(Equal(11))
+			values, err := emap.FetchByIndex("index2")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(values).To(Equal([]int{1, 2}))
+			Expect(emap.KeyNum()).To(Equal(2))
+			Expect(emap.IndexNum()).To(Equal(2))
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+
+			err = emap.DeleteByIndex("index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(emap.HasKey("key1")).To(Equal(false))
+			Expect(emap.KeyNumOfIndex("index2")).To(Equal(1))
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+		})
+
+		It("Given a typed unlock emap, when call Transform and Foreach, it should apply callback with typed key and value.", func() {
+			emap := NewTypedUnlockEMap[string, int, int]()
+			emap.Insert("key1", 1, 100)
+			emap.Insert("key2", 2, 100)
+
+			targets, err := emap.Transform(func(key string, value int) (int, error) {
+				return value + 10, nil
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(targets).To(Equal(map[string]int{"key1": 11, "key2": 12}))
+
+			total := 0
+			emap.Foreach(func(key string, value int) {
+				total += value
+			})
+			Expect(total).To(Equal(3))
+		})
+
+		It("Given an interval to a typed expirable emap, when the value is expired, it should be collected.", func() {
+			emap := NewTypedExpirableEMap[string, *expirebleStruct, string](100)
+			defer emap.Close()
+			value := new(expirebleStruct)
+			err := emap.Insert("key1", value, "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			time.Sleep(300 * time.Millisecond)
+			Expect(emap.HasKey("key1")).To(Equal(true))
+			value.expired = true
+			time.Sleep(300 * time.Millisecond)
+			Expect(emap.HasKey("key1")).To(Equal(false))
+			Expect(emap.HasIndex("index1")).To(Equal(false))
+		})
+
+		It("Given a typed expirable emap, when plain values are inserted with a ttl, they should be collected after the ttl.", func() {
+			emap := NewTypedExpirableEMap[string, int, string](100)
+			defer emap.Close()
+			err := emap.InsertWithTTL("key1", 1, 200*time.Millisecond, "index1")
+			Expect(err).ShouldNot(HaveOccurred())
+			err = emap.Insert("key2", 2, "index1")
+			Expect(errors.Is(err, ErrTypeMismatch)).To(Equal(true))
+
+			Eventually(func() bool { return emap.HasKey("key1") }).Should(Equal(false))
+			Expect(emap.HasIndex("index1")).To(Equal(false))
+		})
+
+		It("Given an emap without expiration, when insert with a ttl, it should return ErrNoExpiration.", func() {
+			generic := NewGenericEMap()
+			err := generic.InsertWithTTL("key1", "value1", time.Hour)
+			Expect(err).To(Equal(ErrNoExpiration))
+			Expect(generic.HasKey("key1")).To(Equal(false))
+			err = generic.InsertWithTTL("key1", "value1", 0)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			typed := NewTypedEMap[string, int, string]()
+			err = typed.InsertWithTTL("key1", 1, time.Hour)
+			Expect(err).To(Equal(ErrNoExpiration))
+			lazy := NewTypedEMap[string, int, string](WithLazyExpiration(true))
+			err = lazy.InsertWithTTL("key1", 1, time.Hour)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("benchmark emap", func() {
+		BeforeEach(func() {
+		})
+
+		AfterEach(func() {
+		})
+
+		Measure("Benchmark the goalng map performance", func(b Benchmarker) {
+			goMap := make(map[interface{}]interface{})
+			b.Time("GoMap", func() {
+				GoMapAdd(goMap, 200000)
+				GoMapGet(goMap, 200000)
+				GoMapDel(goMap, 200000)
+			})
+		}, 10)
+
+		Measure("Benchmark the generic emap performance", func(b Benchmarker) {
+			eMap := NewGenericEMap()
+			EMapRuntime := b.Time("GenericEMap", func() {
+				EMapAdd(eMap, 200000)
+				EMapGet(eMap, 200000)
+				EMapDel(eMap, 200000)
+			})
+
+			Ω(EMapRuntime.Seconds()).Should(BeNumerically("<", 2), "Add/Get/Del 200000 values shouldn't take too long.")
+		}, 10)
+
+		Measure("Benchmark the stric emap performance", func(b Benchmarker) {
+			eMap, _ := NewStrictEMap("sample", &expirebleStruct{false, 0}, 123)
+			EMapRuntime := b.Time("StrictEMap", func() {
+				EMapAdd(eMap, 200000)
+				EMapGet(eMap, 200000)
+				EMapDel(eMap, 200000)
+			})
+
+			Ω(EMapRuntime.Seconds()).Should(BeNumerically("<", 2), "Add/Get/Del 200000 values shouldn't take too long.")
+		}, 10)
+
+		Measure("Benchmark the nolock emap performance", func(b Benchmarker) {
+			eMap := NewUnlockEMap()
+			EMapRuntime := b.Time("NolockEMap", func() {
+				EMapAdd(eMap, 200000)
+				EMapGet(eMap, 200000)
+				EMapDel(eMap, 200000)
+			})
+
+			Ω(EMapRuntime.Seconds()).Should(BeNumerically("<", 2), "Add/Get/Del 200000 values shouldn't take too long.")
+		}, 10)
+	})
+
+	Context("debug", func() {
+		var (
+			emap *GenericEMap
+		)
+
+		BeforeEach(func() {
+			emap = NewGenericEMap()
+		})
+
+		AfterEach(func() {
+		})
+
+		It("Fix the unconsistency caused by deleteByKey", func() {
+			emap.Insert("key1", "value1", "index1", "index2", "index3")
+			emap.Insert("key2", "value2", "index1", "index2", "index3")
+			emap.Insert("key3", "value3", "index1", "index2", "index3")
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+
+			emap.DeleteByKey("key1")
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+		})
+
+		It("Fix the unconsistency caused by deleteByIndex", func() {
+			emap.Insert("key1", "value1", "index1", "index2", "index3")
+			emap.Insert("key2", "value2", "index1", "index2", "index3")
+			emap.Insert("key3", "value3", "index1", "index2", "index3")
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+
+			emap.DeleteByIndex("index1")
+			Expect(emap.check()).ShouldNot(HaveOccurred())
+		})
+	})
+})
+
+func NewStrictEmapWrapper(key interface{}, value interface{}, index interface{}, options ...Option) (emap EMap[interface{}, interface{}, interface{}]) {
+	emap, _ = NewStrictEMap(key, value, index, options...)
+	return
+}
+
+type evictCounter interface {
+	EvictNum(reason EvictReason) int
+}
+
+func stringSizer(key interface{}, value interface{}) int {
+	return len(value.(string))
 }
 
 type expirebleStruct struct {
@@ -646,13 +2309,13 @@ func GoMapDel(goMap map[interface{}]interface{}, number int) {
 	}
 }
 
-func EMapAdd(emap EMap, number int) {
+func EMapAdd(emap EMap[interface{}, interface{}, interface{}], number int) {
 	for i := 0; i < number; i++ {
 		emap.Insert(string(i), &expirebleStruct{false, i})
 	}
 }
 
-func EMapGet(emap EMap, number int) (dump interface{}) {
+func EMapGet(emap EMap[interface{}, interface{}, interface{}], number int) (dump interface{}) {
 	for i := 0; i < number; i++ {
 		value, _ := emap.FetchByKey(string(i))
 		dump = value.(*expirebleStruct).number
@@ -660,7 +2323,7 @@ func EMapGet(emap EMap, number int) (dump interface{}) {
 	return
 }
 
-func EMapDel(emap EMap, number int) {
+func EMapDel(emap EMap[interface{}, interface{}, interface{}], number int) {
 	for i := 0; i < number; i++ {
 		emap.DeleteByKey(string(i))
 	}
@@ -0,0 +1,96 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The sentinel errors returned by all the emaps of this package.
+// The errors are always wrapped by KeyError, IndexError, ValueError or ConstraintError, so use errors.Is to check them.
+var (
+	ErrKeyNotFound     = errors.New("key not exist")
+	ErrKeyExists       = errors.New("key duplicate")
+	ErrIndexNotFound   = errors.New("index not exist")
+	ErrIndexExists     = errors.New("index duplicate")
+	ErrTypeMismatch    = errors.New("type mismatch")
+	ErrTooLarge        = errors.New("size exceeds budget")
+	ErrUniqueViolation = errors.New("unique index violated")
+)
+
+// ErrClosed is returned by the operations of an emap which has been closed.
+var ErrClosed = errors.New("emap closed")
+
+// ErrUnordered is returned by the ordered operations of an emap created without WithOrderedIndex.
+var ErrUnordered = errors.New("index unordered")
+
+// ErrNoExpiration is returned by InsertWithTTL of an emap having neither an expiration checker nor lazy expiration.
+var ErrNoExpiration = errors.New("expiration disabled")
+
+// KeyError records an error and the key which caused it.
+type KeyError struct {
+	Key interface{}
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("key %v: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the underlying sentinel error.
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// IndexError records an error and the index which caused it.
+type IndexError struct {
+	Index interface{}
+	Err   error
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("index %v: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying sentinel error.
+func (e *IndexError) Unwrap() error {
+	return e.Err
+}
+
+// ValueError records an error and the value which caused it.
+type ValueError struct {
+	Value interface{}
+	Err   error
+}
+
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("value %v: %v", e.Value, e.Err)
+}
+
+// Unwrap returns the underlying sentinel error.
+func (e *ValueError) Unwrap() error {
+	return e.Err
+}
+
+// ConstraintError records a violation of a unique index family, the index and the key already having the index.
+// The family is empty for the default indices of the emap.
+type ConstraintError struct {
+	Family string
+	Index  interface{}
+	Key    interface{}
+	Err    error
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Family == "" {
+		return fmt.Sprintf("index %v: %v by key %v", e.Index, e.Err, e.Key)
+	}
+
+	return fmt.Sprintf("index %v of %s: %v by key %v", e.Index, e.Family, e.Err, e.Key)
+}
+
+// Unwrap returns the underlying sentinel error.
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
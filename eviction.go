@@ -0,0 +1,78 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+// EvictReason tells why a value is removed from the emap.
+type EvictReason int
+
+const (
+	// EvictDeleted means the value is deleted by DeleteByKey or DeleteByIndex.
+	EvictDeleted EvictReason = iota
+	// EvictExpired means the value is deleted by the expiration checker.
+	EvictExpired
+	// EvictCapacity means the value is evicted by the evict policy since the capacity of the emap is exceeded.
+	EvictCapacity
+	// EvictSize means the value is evicted by the evict policy since the size budget of the emap is exceeded.
+	EvictSize
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictDeleted:
+		return "deleted"
+	case EvictExpired:
+		return "expired"
+	case EvictCapacity:
+		return "capacity"
+	case EvictSize:
+		return "size"
+	}
+
+	return "unknown"
+}
+
+// eviction records a value removed from the emap which is waiting for the evict callback.
+type eviction[K comparable, V any, I comparable] struct {
+	key     K
+	value   V
+	indices []I
+	reason  EvictReason
+}
+
+// evict records the value of the input key for the evict callback before it is removed.
+// The number of the removed values of each reason is counted even if no evict callback is registered.
+func (s *store[K, V, I]) evict(key K, reason EvictReason) {
+	s.evictions[reason]++
+	if s.onEvict == nil {
+		return
+	}
+
+	indices := make([]I, len(s.keys[key]))
+	copy(indices, s.keys[key])
+	s.evicted = append(s.evicted, eviction[K, V, I]{key, s.values[key], indices, reason})
+}
+
+// write runs the input operation with the write locker held.
+// The locker is released even if the operation panics, e.g. in a callback function of the user.
+// The evict callback is fired for each value removed by the operation after the locker is released,
+// so the callback may safely call back into the emap.
+func (s *store[K, V, I]) write(l locker, operation func() error) error {
+	var evicted []eviction[K, V, I]
+	var onEvict func(K, V, []I, EvictReason)
+	err := func() error {
+		l.Lock()
+		defer func() {
+			evicted, onEvict = s.evicted, s.onEvict
+			s.evicted = nil
+			l.Unlock()
+		}()
+
+		return operation()
+	}()
+
+	for _, each := range evicted {
+		onEvict(each.key, each.value, each.indices, each.reason)
+	}
+
+	return err
+}
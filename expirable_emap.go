@@ -3,10 +3,12 @@
 package emap
 
 import (
+	"context"
 	"time"
 )
 
-// ExpirableValue is the interface which must be implemented by all the value in the expirable EMap.
+// ExpirableValue is the interface which must be implemented by all the value in the expirable EMap,
+// unless the value is inserted with a ttl.
 type ExpirableValue interface {
 	// IsExpired returns if the value is expired.
 	// If true, the value will be deleted automatically.
@@ -17,32 +19,223 @@ type ExpirableValue interface {
 // The expiration checker will check all the values in the emap with the period of input interval(milliseconds).
 // All value inserted into the expirable emap must implements ExpirableValue interface of this package.
 // If a value is expired, it will be deleted automatically.
-func NewExpirableEMap(interval int) *GenericEMap {
+// With WithTTL option, values not implementing ExpirableValue are accepted and deleted after the default ttl.
+// Call Close to stop the expiration checker when the emap is no longer used.
+func NewExpirableEMap(interval int, options ...Option) *GenericEMap {
+	return NewExpirableEMapContext(context.Background(), interval, options...)
+}
+
+// NewExpirableEMapContext creates a new generic emap with an expiration checker bound to the input context.
+// It works as same as NewExpirableEMap except that the emap is closed automatically when the context is done,
+// even if the interval is not positive and no expiration checker is started.
+func NewExpirableEMapContext(ctx context.Context, interval int, options ...Option) *GenericEMap {
 	instance := new(GenericEMap)
-	instance.values = make(map[interface{}]interface{})
-	instance.keys = make(map[interface{}][]interface{})
-	instance.indices = make(map[interface{}][]interface{})
+	instance.init(options...)
+	instance.done = make(chan struct{})
+
+	if interval > 0 {
+		instance.collected = true
+		go instance.collect(ctx, interval)
+	} else if ctx.Done() != nil {
+		go instance.watch(ctx)
+	}
+
+	return instance
+}
+
+// InsertWithTTL pushes a new value into emap with input key, ttl and indices.
+// The value will be deleted automatically by the expiration checker after the ttl, even if it does not implement ExpirableValue.
+// A non-positive ttl means the value never expires by time.
+// Input key must not be duplicated.
+// Input indices are optional.
+// Try to insert with a positive ttl into an emap having neither an expiration checker nor lazy expiration will cause ErrNoExpiration,
+// since the value would never expire.
+func (m *GenericEMap) InsertWithTTL(key interface{}, value interface{}, ttl time.Duration, indices ...interface{}) error {
+	return m.write(&m.mtx, func() error {
+		if m.closed {
+			return ErrClosed
+		}
+		if err := m.checkTTL(ttl); err != nil {
+			return err
+		}
+
+		return m.insertWithTTL(key, value, ttl, indices...)
+	})
+}
+
+// Touch refreshes the deadline of the value of the input key to now plus its ttl.
+// Touching a value without ttl has no effect.
+// Try to touch a non-existed key will cause an error return.
+func (m *GenericEMap) Touch(key interface{}) (err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		if !m.alive(key, now, stale) {
+			err = &KeyError{Key: key, Err: ErrKeyNotFound}
+			return
+		}
+
+		m.touch(key, now)
+	})
+
+	return
+}
+
+// Close stops the expiration checker and releases all the values in the emap.
+// Any operation returning an error will return ErrClosed after the emap is closed, including Close itself.
+func (m *GenericEMap) Close() error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.closed = true
+	close(m.done)
+	m.clear()
+
+	return nil
+}
+
+// watch closes the emap without an expiration checker when the context is done.
+func (m *GenericEMap) watch(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		m.Close()
+	case <-m.done:
+	}
+}
+
+func (m *GenericEMap) collect(ctx context.Context, interval int) {
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.expire(&m.mtx)
+		case <-ctx.Done():
+			m.Close()
+			return
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// NewTypedExpirableEMap creates a new typed emap with an expiration checker.
+// The expiration checker will check all the values in the emap with the period of input interval(milliseconds).
+// All value inserted into the expirable emap must implements ExpirableValue interface of this package.
+// If a value is expired, it will be deleted automatically.
+// With WithTTL option, values not implementing ExpirableValue are accepted and deleted after the default ttl,
+// which are collected by their deadlines instead of checking every value.
+// Call Close to stop the expiration checker when the emap is no longer used.
+func NewTypedExpirableEMap[K comparable, V any, I comparable](interval int, options ...Option) *TypedEMap[K, V, I] {
+	return NewTypedExpirableEMapContext[K, V, I](context.Background(), interval, options...)
+}
+
+// NewTypedExpirableEMapContext creates a new typed emap with an expiration checker bound to the input context.
+// It works as same as NewTypedExpirableEMap except that the emap is closed automatically when the context is done,
+// even if the interval is not positive and no expiration checker is started.
+func NewTypedExpirableEMapContext[K comparable, V any, I comparable](ctx context.Context, interval int, options ...Option) *TypedEMap[K, V, I] {
+	instance := new(TypedEMap[K, V, I])
+	instance.init(options...)
+	instance.done = make(chan struct{})
 
 	if interval > 0 {
-		instance.interval = interval
-		go instance.collect(interval)
+		instance.collected = true
+		go instance.collect(ctx, interval)
+	} else if ctx.Done() != nil {
+		go instance.watch(ctx)
 	}
 
 	return instance
 }
 
-func (m *GenericEMap) collect(interval int) {
+// InsertWithTTL pushes a new value into emap with input key, ttl and indices.
+// The value will be deleted automatically by the expiration checker after the ttl, even if it does not implement ExpirableValue.
+// A non-positive ttl means the value never expires by time.
+// Input key must not be duplicated.
+// Input indices are optional.
+// Try to insert with a positive ttl into an emap having neither an expiration checker nor lazy expiration will cause ErrNoExpiration,
+// since the value would never expire.
+func (m *TypedEMap[K, V, I]) InsertWithTTL(key K, value V, ttl time.Duration, indices ...I) error {
+	return m.write(&m.mtx, func() error {
+		if m.closed {
+			return ErrClosed
+		}
+		if err := m.checkTTL(ttl); err != nil {
+			return err
+		}
+
+		return m.insertWithTTL(key, value, ttl, indices...)
+	})
+}
+
+// Touch refreshes the deadline of the value of the input key to now plus its ttl.
+// Touching a value without ttl has no effect.
+// Try to touch a non-existed key will cause an error return.
+func (m *TypedEMap[K, V, I]) Touch(key K) (err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]K) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		if !m.alive(key, now, stale) {
+			err = &KeyError{Key: key, Err: ErrKeyNotFound}
+			return
+		}
+
+		m.touch(key, now)
+	})
+
+	return
+}
+
+// Close stops the expiration checker and releases all the values in the emap.
+// Any operation returning an error will return ErrClosed after the emap is closed, including Close itself.
+func (m *TypedEMap[K, V, I]) Close() error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.closed = true
+	close(m.done)
+	m.clear()
+
+	return nil
+}
+
+// watch closes the emap without an expiration checker when the context is done.
+func (m *TypedEMap[K, V, I]) watch(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		m.Close()
+	case <-m.done:
+	}
+}
+
+func (m *TypedEMap[K, V, I]) collect(ctx context.Context, interval int) {
 	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-ticker.C:
-			m.mtx.Lock()
-			for key, value := range m.values {
-				if value.(ExpirableValue).IsExpired() {
-					deleteByKey(m.values, m.keys, m.indices, key)
-				}
-			}
-			m.mtx.Unlock()
+			m.expire(&m.mtx)
+		case <-ctx.Done():
+			m.Close()
+			return
+		case <-m.done:
+			return
 		}
 	}
 }
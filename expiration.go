@@ -0,0 +1,233 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"container/heap"
+	"sync/atomic"
+	"time"
+)
+
+const defaultExpirationBatch = 1024
+
+// WithExpirationBatch sets the max number of values checked or deleted by the expiration checker while holding the locker.
+// The expiration checker releases the locker between batches, so the larger the batch the longer other operations may wait.
+func WithExpirationBatch(batch int) Option {
+	return func(c *config) {
+		c.batch = batch
+	}
+}
+
+// WithSlidingExpiration makes the ttl of a value slide on access.
+// The deadline of a value is refreshed to the access time plus its ttl each time it is fetched by FetchByKey or FetchByIndex,
+// or touched by Touch, so a value is only expired after it is not accessed for a whole ttl.
+func WithSlidingExpiration() Option {
+	return func(c *config) {
+		c.sliding = true
+	}
+}
+
+// checkExpirable checks if the value of the input key can be collected by the expiration checker,
+// which requires the value to implement ExpirableValue unless it has a ttl.
+func (s *store[K, V, I]) checkExpirable(key K, value V, ttl time.Duration) error {
+	if !s.collected || ttl > 0 {
+		return nil
+	}
+
+	if _, scheduled := s.deadlines[key]; scheduled {
+		return nil
+	}
+
+	if _, ok := any(value).(ExpirableValue); !ok {
+		return &ValueError{Value: value, Err: ErrTypeMismatch}
+	}
+
+	return nil
+}
+
+// checkTTL checks if a value inserted with the input ttl will ever expire,
+// which requires either an expiration checker or lazy expiration.
+func (s *store[K, V, I]) checkTTL(ttl time.Duration) error {
+	if ttl > 0 && !s.collected && !s.lazy {
+		return ErrNoExpiration
+	}
+
+	return nil
+}
+
+// deadline is the expiration deadline of a key scheduled in the deadline heap.
+// The accessed time is updated atomically by the read operations holding only the read locker,
+// and is applied to the heap lazily when the scheduled time is due.
+type deadline[K comparable] struct {
+	accessed int64 // unix nano of the last access
+	key      K
+	at       time.Time // scheduled time in the heap
+	ttl      time.Duration
+	pos      int
+}
+
+// expiry returns the actual deadline taking the last access into account.
+func (d *deadline[K]) expiry() time.Time {
+	accessed := atomic.LoadInt64(&d.accessed)
+	if accessed == 0 {
+		return d.at
+	}
+
+	if at := time.Unix(0, accessed).Add(d.ttl); at.After(d.at) {
+		return at
+	}
+
+	return d.at
+}
+
+// deadlineHeap is a min-heap of deadlines, so the next value to expire is always on the top.
+type deadlineHeap[K comparable] []*deadline[K]
+
+func (h deadlineHeap[K]) Len() int           { return len(h) }
+func (h deadlineHeap[K]) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h deadlineHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *deadlineHeap[K]) Push(x interface{}) {
+	d := x.(*deadline[K])
+	d.pos = len(*h)
+	*h = append(*h, d)
+}
+
+func (h *deadlineHeap[K]) Pop() interface{} {
+	old := *h
+	d := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return d
+}
+
+func (s *store[K, V, I]) schedule(key K, ttl time.Duration) {
+	d := &deadline[K]{key: key, at: time.Now().Add(ttl), ttl: ttl}
+	heap.Push(&s.schedules, d)
+	s.deadlines[key] = d
+}
+
+// touch refreshes the last access time of the input key.
+// Only the read locker is required.
+func (s *store[K, V, I]) touch(key K, now time.Time) {
+	if d, exist := s.deadlines[key]; exist {
+		atomic.StoreInt64(&d.accessed, now.UnixNano())
+	}
+}
+
+func (s *store[K, V, I]) unschedule(key K) {
+	if d, exist := s.deadlines[key]; exist {
+		heap.Remove(&s.schedules, d.pos)
+		delete(s.deadlines, key)
+	}
+}
+
+// expireDue handles at most limit due deadlines on the top of the heap and returns the number handled.
+// A due value is deleted, unless it has been accessed since it was scheduled, then it is rescheduled.
+func (s *store[K, V, I]) expireDue(now time.Time, limit int) int {
+	n := 0
+	for n < limit && len(s.schedules) > 0 && !s.schedules[0].at.After(now) {
+		d := s.schedules[0]
+		if at := d.expiry(); at.After(now) {
+			d.at = at
+			heap.Fix(&s.schedules, 0)
+		} else {
+			s.deleteByKey(d.key, EvictExpired)
+		}
+		n++
+	}
+
+	return n
+}
+
+// expire deletes all the expired values in batches.
+// The locker is held for one batch at a time, so a large emap will not stall other operations during the expiration.
+// Due deadlines are popped from the heap, which only touches the values actually due,
+// so values with a ttl are cheaper to expire than values implementing ExpirableValue.
+// The latter are all checked on each call, one batch at a time under the read locker,
+// and only the expired ones of the batch are deleted under the write locker.
+func (s *store[K, V, I]) expire(l locker) {
+	for n := s.batch; n == s.batch; {
+		s.write(l, func() error {
+			n = s.expireDue(time.Now(), s.batch)
+			return nil
+		})
+	}
+
+	// The keys are checked from the end of the set backwards. Removing a key moves the last key into its position,
+	// so the unchecked keys stay below the position checked next even if keys are deleted between batches.
+	for end := -1; end != 0; {
+		var candidates []K
+		s.read(l, func(time.Time, *[]K) {
+			keys := s.expirables.keys
+			if end < 0 || end > len(keys) {
+				end = len(keys)
+			}
+			start := end - s.batch
+			if start < 0 {
+				start = 0
+			}
+			for _, key := range keys[start:end] {
+				if any(s.values[key]).(ExpirableValue).IsExpired() {
+					candidates = append(candidates, key)
+				}
+			}
+			end = start
+		})
+
+		if len(candidates) == 0 {
+			continue
+		}
+		s.write(l, func() error {
+			for _, key := range candidates {
+				if value, exist := s.values[key]; exist && any(value).(ExpirableValue).IsExpired() {
+					s.deleteByKey(key, EvictExpired)
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// keySet is a set of keys which can be walked by position, so a walk can be resumed after the locker is released.
+type keySet[K comparable] struct {
+	pos  map[K]int // key -> position in keys
+	keys []K
+}
+
+func newKeySet[K comparable]() keySet[K] {
+	return keySet[K]{pos: make(map[K]int)}
+}
+
+func (s *keySet[K]) has(key K) bool {
+	_, exist := s.pos[key]
+	return exist
+}
+
+func (s *keySet[K]) add(key K) {
+	if s.has(key) {
+		return
+	}
+
+	s.pos[key] = len(s.keys)
+	s.keys = append(s.keys, key)
+}
+
+// remove moves the last key into the position of the removed one.
+func (s *keySet[K]) remove(key K) {
+	i, exist := s.pos[key]
+	if !exist {
+		return
+	}
+
+	last := s.keys[len(s.keys)-1]
+	s.keys[i] = last
+	s.pos[last] = i
+	s.keys = s.keys[:len(s.keys)-1]
+	delete(s.pos, key)
+}
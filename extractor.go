@@ -0,0 +1,89 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+// Extractor derives the indices from a value in the emap.
+type Extractor func(value interface{}) []interface{}
+
+// WithIndexExtractor registers an index extractor which derives the indices from the value.
+// The indices are derived when a value is inserted by Insert or Upsert, and are added along with the input indices.
+// When a value is replaced by Update or Upsert, only the derived indices changed are removed or added.
+// The derived indices must be of the index type of the emap, otherwise an error will be returned.
+// More than one extractor can be registered by using this option repeatedly.
+func WithIndexExtractor(extractor Extractor) Option {
+	return func(c *config) {
+		c.extractors = append(c.extractors, extractor)
+	}
+}
+
+// extract derives the indices from the input value by all the extractors without duplication.
+func (s *store[K, V, I]) extract(value V) ([]I, error) {
+	var indices []I
+	for _, extractor := range s.extractors {
+		for _, each := range extractor(value) {
+			index, ok := each.(I)
+			if !ok {
+				return nil, &IndexError{Index: each, Err: ErrTypeMismatch}
+			}
+			if s.validIndex != nil {
+				if err := s.validIndex(index); err != nil {
+					return nil, err
+				}
+			}
+			if !contains(indices, index) {
+				indices = append(indices, index)
+			}
+		}
+	}
+
+	return indices, nil
+}
+
+// merge appends the derived indices which are not in the input indices to a copy of the input indices.
+// The derived indices appended are returned too, since only them are managed by the extractors.
+func merge[I comparable](indices []I, derived []I) ([]I, []I) {
+	merged := append([]I(nil), indices...)
+	var added []I
+	for _, index := range derived {
+		if !contains(merged, index) {
+			merged = append(merged, index)
+			added = append(added, index)
+		}
+	}
+
+	return merged, added
+}
+
+// reindex replaces the derived indices of the input key with the input derived indices.
+// The derived indices not changed are kept as is, and the ones already added by hand are left to the user.
+func (s *store[K, V, I]) reindex(key K, derived []I) {
+	old := s.derived[key]
+	for _, index := range old {
+		if !contains(derived, index) {
+			s.removeIndex(key, index)
+		}
+	}
+
+	var kept []I
+	for _, index := range derived {
+		if contains(old, index) || s.addIndex(key, index) == nil {
+			kept = append(kept, index)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(s.derived, key)
+	} else {
+		s.derived[key] = kept
+	}
+}
+
+func contains[I comparable](indices []I, index I) bool {
+	for _, each := range indices {
+		if each == index {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,241 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"time"
+)
+
+// IndexFamily is a named index namespace of an emap returned by the Index method of the emap.
+// Each index family has its own index storage, so the same index in different families never collides,
+// e.g. the index 1 of the family "user" and the index 1 of the family "group".
+// The indices of the families are removed together with the values, but they are not passed to the evict callback
+// and not included in the snapshots.
+// An index family shares the locker of its emap, so it is concurrent safe as long as its emap is.
+type IndexFamily[K comparable, V any, I comparable] struct {
+	name    string
+	store   *store[K, V, I]
+	locker  locker
+	closed  *bool            // nil if the emap can not be closed
+	checker checker[K, V, I] // nil unless the emap is a strict emap
+}
+
+// family is the index storage of a named index family.
+// Unlike the default index storage, only the keys having indices in the family are kept in the key storage.
+type family[K comparable, I comparable] struct {
+	keys    map[K][]I // key -> indices
+	indices map[I][]K // index -> keys
+}
+
+func (f *IndexFamily[K, V, I]) check(key *K, index I) error {
+	if f.closed != nil && *f.closed {
+		return ErrClosed
+	}
+
+	if f.checker == nil {
+		return nil
+	}
+
+	if key != nil {
+		if err := f.checker.checkKey(*key); err != nil {
+			return err
+		}
+	}
+
+	return f.checker.checkIndex(index)
+}
+
+// AddIndex add the input index of the family to the value in the emap of the input key.
+// Try to add a duplicate index will cause an error return.
+// Try to add an index to a non-existed value will cause an error return.
+func (f *IndexFamily[K, V, I]) AddIndex(key K, index I) error {
+	return f.store.write(f.locker, func() error {
+		if err := f.check(&key, index); err != nil {
+			return err
+		}
+
+		return f.store.addFamilyIndex(f.name, key, index)
+	})
+}
+
+// RemoveIndex remove the input index of the family from the value in the emap of the input key.
+// Try to delete a non-existed index will cause an error return.
+// Try to delete an index from a non-existed value will cause an error return.
+func (f *IndexFamily[K, V, I]) RemoveIndex(key K, index I) error {
+	return f.store.write(f.locker, func() error {
+		if err := f.check(&key, index); err != nil {
+			return err
+		}
+
+		return f.store.removeFamilyIndex(f.name, key, index)
+	})
+}
+
+// FetchByIndex gets the all values in the emap by input index of the family.
+// Try to fetch a non-existed index will cause an error return.
+func (f *IndexFamily[K, V, I]) FetchByIndex(index I) (values []V, err error) {
+	f.store.read(f.locker, func(now time.Time, stale *[]K) {
+		if err = f.check(nil, index); err != nil {
+			return
+		}
+
+		values, err = f.store.fetchIn(f.store.familyIndices(f.name), index, now, stale)
+	})
+
+	return
+}
+
+// FetchOneByIndex gets the first value in the emap by input index of the family, which is the only one if the family is unique.
+// Try to fetch a non-existed index will cause an error return.
+func (f *IndexFamily[K, V, I]) FetchOneByIndex(index I) (value V, err error) {
+	f.store.read(f.locker, func(now time.Time, stale *[]K) {
+		if err = f.check(nil, index); err != nil {
+			return
+		}
+
+		value, err = f.store.fetchOneIn(f.store.familyIndices(f.name), index, now, stale)
+	})
+
+	return
+}
+
+// DeleteByIndex deletes all the values in the emap by input index of the family.
+// Try to delete a non-existed index will cause an error return.
+func (f *IndexFamily[K, V, I]) DeleteByIndex(index I) error {
+	return f.store.write(f.locker, func() error {
+		if err := f.check(nil, index); err != nil {
+			return err
+		}
+
+		return f.store.deleteByFamilyIndex(f.name, index, EvictDeleted)
+	})
+}
+
+// KeyNumOfIndex returns the total key number of the input index of the family in the emap.
+func (f *IndexFamily[K, V, I]) KeyNumOfIndex(index I) (num int) {
+	f.store.read(f.locker, func(now time.Time, stale *[]K) {
+		num = f.store.keyNumIn(f.store.familyIndices(f.name), index, now, stale)
+	})
+
+	return
+}
+
+// HasIndex returns if the input index of the family exists in the emap.
+func (f *IndexFamily[K, V, I]) HasIndex(index I) bool {
+	return f.KeyNumOfIndex(index) > 0
+}
+
+// IndexNum returns the total index number of the family in the emap.
+func (f *IndexFamily[K, V, I]) IndexNum() int {
+	f.locker.RLock()
+	defer f.locker.RUnlock()
+
+	return len(f.store.familyIndices(f.name))
+}
+
+// familyIndices returns the index storage of the named family, nil if the family has no index.
+// The empty name means the default indices.
+func (s *store[K, V, I]) familyIndices(name string) map[I][]K {
+	if name == "" {
+		return s.indices
+	}
+
+	if f, exist := s.families[name]; exist {
+		return f.indices
+	}
+
+	return nil
+}
+
+func (s *store[K, V, I]) addFamilyIndex(name string, key K, index I) error {
+	if name == "" {
+		return s.addIndex(key, index)
+	}
+
+	if _, exist := s.keys[key]; !exist {
+		return &KeyError{Key: key, Err: ErrKeyNotFound}
+	}
+	if err := s.checkUnique(name, key, index); err != nil {
+		return err
+	}
+
+	f, exist := s.families[name]
+	if !exist {
+		f = &family[K, I]{keys: make(map[K][]I), indices: make(map[I][]K)}
+		s.families[name] = f
+	}
+
+	s.save(key)
+	s.saveFamilyIndex(name, index)
+	s.version++
+
+	if _, exist := f.keys[key]; !exist {
+		f.keys[key] = nil
+	}
+	err := addIndex(f.keys, f.indices, key, index)
+	if len(f.keys[key]) == 0 {
+		delete(f.keys, key)
+	}
+
+	return err
+}
+
+func (s *store[K, V, I]) removeFamilyIndex(name string, key K, index I) error {
+	if name == "" {
+		return s.removeIndex(key, index)
+	}
+
+	if _, exist := s.keys[key]; !exist {
+		return &KeyError{Key: key, Err: ErrKeyNotFound}
+	}
+
+	f, exist := s.families[name]
+	if !exist {
+		return &IndexError{Index: index, Err: ErrIndexNotFound}
+	}
+	if _, exist := f.keys[key]; !exist {
+		return &IndexError{Index: index, Err: ErrIndexNotFound}
+	}
+
+	s.save(key)
+	s.saveFamilyIndex(name, index)
+	s.version++
+
+	err := removeIndex(f.keys, f.indices, key, index)
+	if len(f.keys[key]) == 0 {
+		delete(f.keys, key)
+	}
+
+	return err
+}
+
+func (s *store[K, V, I]) deleteByFamilyIndex(name string, index I, reason EvictReason) error {
+	indices := s.familyIndices(name)
+	if _, exist := indices[index]; !exist {
+		return &IndexError{Index: index, Err: ErrIndexNotFound}
+	}
+
+	keys := make([]K, len(indices[index]))
+	copy(keys, indices[index])
+
+	for _, key := range keys {
+		s.deleteByKey(key, reason)
+	}
+
+	return nil
+}
+
+// unindex removes the input key from all the index families.
+func (s *store[K, V, I]) unindex(key K) {
+	for _, f := range s.families {
+		indices, exist := f.keys[key]
+		if !exist {
+			continue
+		}
+
+		for _, index := range append([]I(nil), indices...) {
+			removeIndex(f.keys, f.indices, key, index)
+		}
+		delete(f.keys, key)
+	}
+}
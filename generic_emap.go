@@ -3,27 +3,25 @@
 package emap
 
 import (
-	"errors"
-	"reflect"
 	"sync"
+	"time"
 )
 
 // GenericEMap has a read-write locker inside so it is concurrent safe.
 // The value, key and index type is unlimited in the generic emap.
 type GenericEMap struct {
-	mtx      sync.RWMutex
-	interval int
-	values   map[interface{}]interface{}   // key -> value
-	keys     map[interface{}][]interface{} // key -> indices
-	indices  map[interface{}][]interface{} // index -> keys
+	mtx    sync.RWMutex
+	closed bool
+	done   chan struct{}
+	store[interface{}, interface{}, interface{}]
 }
 
 // NewGenericEMap creates a new generic emap.
-func NewGenericEMap() *GenericEMap {
+// Options such as WithMaxEntries are optional.
+func NewGenericEMap(options ...Option) *GenericEMap {
 	instance := new(GenericEMap)
-	instance.values = make(map[interface{}]interface{})
-	instance.keys = make(map[interface{}][]interface{})
-	instance.indices = make(map[interface{}][]interface{})
+	instance.init(options...)
+	instance.done = make(chan struct{})
 
 	return instance
 }
@@ -37,15 +35,12 @@ func (m *GenericEMap) KeyNum() int {
 }
 
 // KeyNumOfIndex returns the total key number of the input index in the emap.
-func (m *GenericEMap) KeyNumOfIndex(index interface{}) int {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
-
-	if keys, exist := m.indices[index]; exist {
-		return len(keys)
-	}
+func (m *GenericEMap) KeyNumOfIndex(index interface{}) (num int) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		num = m.keyNumOfIndex(index, now, stale)
+	})
 
-	return 0
+	return
 }
 
 // IndexNum returns the total index number in the emap.
@@ -56,6 +51,23 @@ func (m *GenericEMap) IndexNum() int {
 	return len(m.indices)
 }
 
+// Size returns the total size of the values in the emap estimated by the sizer of WithMaxSize.
+// It is always 0 if no sizer is given.
+func (m *GenericEMap) Size() int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return m.size
+}
+
+// EvictNum returns the total number of the values removed from the emap for the input reason.
+func (m *GenericEMap) EvictNum(reason EvictReason) int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return m.evictions[reason]
+}
+
 // IndexNumOfKey returns the total index number of the input key in the emap.
 func (m *GenericEMap) IndexNumOfKey(key interface{}) int {
 	m.mtx.RLock()
@@ -69,79 +81,363 @@ func (m *GenericEMap) IndexNumOfKey(key interface{}) int {
 }
 
 // HasKey returns if the input key exists in the emap.
-func (m *GenericEMap) HasKey(key interface{}) bool {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
-
-	if _, exist := m.keys[key]; exist {
-		return true
-	}
+func (m *GenericEMap) HasKey(key interface{}) (exist bool) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		exist = m.hasKey(key, now, stale)
+	})
 
-	return false
+	return
 }
 
 // HasIndex returns if the input index exists in the emap.
-func (m *GenericEMap) HasIndex(index interface{}) bool {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
+func (m *GenericEMap) HasIndex(index interface{}) (exist bool) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		exist = m.hasIndex(index, now, stale)
+	})
 
-	if _, exist := m.indices[index]; exist {
-		return true
-	}
-
-	return false
+	return
 }
 
 // Insert pushes a new value into emap with input key and indices.
 // Input key must not be duplicated.
 // Input indices are optional.
 func (m *GenericEMap) Insert(key interface{}, value interface{}, indices ...interface{}) error {
-	m.mtx.Lock()
-	defer m.mtx.Unlock()
+	return m.write(&m.mtx, func() error {
+		if m.closed {
+			return ErrClosed
+		}
 
-	if m.interval > 0 {
-		if _, has := reflect.TypeOf(value).MethodByName("IsExpired"); !has {
-			return errors.New("value type wrong")
+		return m.insert(key, value, indices...)
+	})
+}
+
+// Upsert pushes the value into emap with input key and indices.
+// If the key exists, its value is replaced in place and its indices are replaced by the input indices,
+// while the indices derived by the index extractors follow the new value.
+// Input indices are optional.
+func (m *GenericEMap) Upsert(key interface{}, value interface{}, indices ...interface{}) error {
+	return m.write(&m.mtx, func() error {
+		if m.closed {
+			return ErrClosed
+		}
+
+		return m.upsert(key, value, indices...)
+	})
+}
+
+// Update replaces the value in the emap of the input key in place, the indices of the key are kept.
+// Try to update a non-existed key will cause an error return.
+func (m *GenericEMap) Update(key interface{}, value interface{}) error {
+	return m.write(&m.mtx, func() error {
+		if m.closed {
+			return ErrClosed
+		}
+
+		return m.update(key, value)
+	})
+}
+
+// Compute replaces the value in the emap of the input key by the result of the callback function atomically.
+// The callback function is called with the current value and whether it exists, and returns the new value and whether to keep it.
+// If keep is false the value is deleted, otherwise it is replaced in place or inserted without indices.
+// The callback function is called with the locker held, so it must not call back into the emap.
+func (m *GenericEMap) Compute(key interface{}, callback func(old interface{}, exist bool) (interface{}, bool)) error {
+	return m.write(&m.mtx, func() error {
+		if m.closed {
+			return ErrClosed
+		}
+
+		return m.compute(key, func(old interface{}, exist bool) (interface{}, bool, error) {
+			value, keep := callback(old, exist)
+			return value, keep, nil
+		})
+	})
+}
+
+// CompareAndSwap replaces the value in the emap of the input key only if the current value equals to old, and returns if swapped.
+// Values of uncomparable types, such as slices and maps, never equal.
+// Try to swap a non-existed key will cause an error return.
+func (m *GenericEMap) CompareAndSwap(key interface{}, old interface{}, value interface{}) (swapped bool, err error) {
+	m.write(&m.mtx, func() error {
+		if m.closed {
+			err = ErrClosed
+			return err
+		}
+
+		swapped, err = m.compareAndSwap(key, old, value)
+		return err
+	})
+
+	return
+}
+
+// LoadOrStore returns the value in the emap of the input key if it exists and loaded is true.
+// Otherwise it pushes the input value into emap with input key and indices, and returns the input value.
+func (m *GenericEMap) LoadOrStore(key interface{}, value interface{}, indices ...interface{}) (actual interface{}, loaded bool, err error) {
+	m.write(&m.mtx, func() error {
+		if m.closed {
+			err = ErrClosed
+			return err
+		}
+
+		actual, loaded, err = m.loadOrStore(key, value, indices...)
+		return err
+	})
+
+	return
+}
+
+// Txn runs the callback function as a transaction with the write locker of the emap held,
+// so other operations never see the intermediate states of the transaction.
+// If the callback function returns an error, all the changes made by the transaction are rolled back and the error is returned.
+// The callback function must not call back into the emap except through the input transaction.
+func (m *GenericEMap) Txn(callback func(tx Tx[interface{}, interface{}, interface{}]) error) error {
+	return m.write(&m.mtx, func() error {
+		if m.closed {
+			return ErrClosed
 		}
-	}
 
-	return insert(m.values, m.keys, m.indices, key, value, indices...)
+		return m.txn(&txn[interface{}, interface{}, interface{}]{store: &m.store}, callback)
+	})
 }
 
 // FetchByKey gets the value in the emap by input key.
 // Try to fetch a non-existed key will cause an error return.
-func (m *GenericEMap) FetchByKey(key interface{}) (interface{}, error) {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
+func (m *GenericEMap) FetchByKey(key interface{}) (value interface{}, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
 
-	return fetchByKey(m.values, key)
+		value, err = m.fetchByKey(key, now, stale)
+	})
+
+	return
 }
 
 // FetchByIndex gets the all values in the emap by input index.
 // Try to fetch a non-existed index will cause an error return.
-func (m *GenericEMap) FetchByIndex(index interface{}) ([]interface{}, error) {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
+func (m *GenericEMap) FetchByIndex(index interface{}) (values []interface{}, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		values, err = m.fetchByIndex(index, now, stale)
+	})
+
+	return
+}
+
+// FetchOneByIndex gets the first value in the emap by input index, which is the only one if the index is unique.
+// Try to fetch a non-existed index will cause an error return.
+func (m *GenericEMap) FetchOneByIndex(index interface{}) (value interface{}, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		value, err = m.fetchOneIn(m.indices, index, now, stale)
+	})
+
+	return
+}
+
+// FetchByIndexRange gets the values in the emap whose indices are between lo and hi inclusively, in the ascending order of the indices.
+// A value having more than one index in the range is returned only once, and an empty range returns no value without error.
+// Try to fetch from an emap created without WithOrderedIndex will cause an error return.
+func (m *GenericEMap) FetchByIndexRange(lo, hi interface{}) (values []interface{}, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		values, err = m.fetchByIndexRange(lo, hi, now, stale)
+	})
+
+	return
+}
+
+// Min gets the smallest index in the emap and all the values of it.
+// Try to get from an emap without any index or created without WithOrderedIndex will cause an error return.
+func (m *GenericEMap) Min() (index interface{}, values []interface{}, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		index, values, err = m.edge(false, now, stale)
+	})
+
+	return
+}
+
+// Max gets the largest index in the emap and all the values of it.
+// Try to get from an emap without any index or created without WithOrderedIndex will cause an error return.
+func (m *GenericEMap) Max() (index interface{}, values []interface{}, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		index, values, err = m.edge(true, now, stale)
+	})
+
+	return
+}
+
+// Ascend applies the input callback function to each index-value pair in the ascending order of the indices until it returns false.
+// A value having more than one index is visited once for each of its indices.
+// The callback function must not call back into the emap.
+// Try to iterate an emap created without WithOrderedIndex will cause an error return.
+func (m *GenericEMap) Ascend(callback func(interface{}, interface{}) bool) (err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		err = m.walk(false, callback, now, stale)
+	})
+
+	return
+}
+
+// Descend applies the input callback function to each index-value pair in the descending order of the indices until it returns false.
+// A value having more than one index is visited once for each of its indices.
+// The callback function must not call back into the emap.
+// Try to iterate an emap created without WithOrderedIndex will cause an error return.
+func (m *GenericEMap) Descend(callback func(interface{}, interface{}) bool) (err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		err = m.walk(true, callback, now, stale)
+	})
+
+	return
+}
+
+// FetchByAllIndices gets the key-value pairs in the emap having all the input indices.
+// Try to fetch without any match will return no pair without error.
+func (m *GenericEMap) FetchByAllIndices(indices ...interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		pairs = m.fetchByAllIndices(indices, now, stale)
+	})
+
+	return
+}
+
+// FetchByAnyIndex gets the key-value pairs in the emap having any of the input indices, each key is returned only once.
+// Try to fetch without any match will return no pair without error.
+func (m *GenericEMap) FetchByAnyIndex(indices ...interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		pairs = m.fetchByAnyIndex(indices, now, stale)
+	})
+
+	return
+}
+
+// FetchExcept gets the key-value pairs in the emap having the input index but none of the excluded indices.
+// Try to fetch without any match will return no pair without error.
+func (m *GenericEMap) FetchExcept(index interface{}, excluded ...interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		pairs = m.fetchExcept(index, excluded, now, stale)
+	})
+
+	return
+}
+
+// FetchKeysByIndex gets the all keys in the emap by input index.
+// Try to fetch a non-existed index will cause an error return.
+func (m *GenericEMap) FetchKeysByIndex(index interface{}) (keys []interface{}, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		keys, err = m.fetchKeysByIndex(index, now, stale)
+	})
+
+	return
+}
+
+// FetchEntriesByIndex gets the all key-value pairs in the emap by input index.
+// Try to fetch a non-existed index will cause an error return.
+func (m *GenericEMap) FetchEntriesByIndex(index interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		pairs, err = m.fetchEntriesByIndex(index, now, stale)
+	})
+
+	return
+}
+
+// FetchIndicesByKey gets the all indices in the emap by input key.
+// Try to fetch a non-existed key will cause an error return.
+func (m *GenericEMap) FetchIndicesByKey(key interface{}) (indices []interface{}, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
 
-	return fetchByIndex(m.values, m.indices, index)
+		indices, err = m.fetchIndicesByKey(key, now, stale)
+	})
+
+	return
 }
 
 // DeleteByKey deletes the value in the emap by input key.
 // Try to delete a non-existed key will cause an error return.
 func (m *GenericEMap) DeleteByKey(key interface{}) error {
-	m.mtx.Lock()
-	defer m.mtx.Unlock()
+	return m.write(&m.mtx, func() error {
+		if m.closed {
+			return ErrClosed
+		}
 
-	return deleteByKey(m.values, m.keys, m.indices, key)
+		return m.deleteByKey(key, EvictDeleted)
+	})
 }
 
 // DeleteByIndex deletes all the values in the emap by input index.
 // Try to delete a non-existed index will cause an error return.
 func (m *GenericEMap) DeleteByIndex(index interface{}) error {
-	m.mtx.Lock()
-	defer m.mtx.Unlock()
+	return m.write(&m.mtx, func() error {
+		if m.closed {
+			return ErrClosed
+		}
 
-	return deleteByIndex(m.values, m.keys, m.indices, index)
+		return m.deleteByIndex(index, EvictDeleted)
+	})
 }
 
 // AddIndex add the input index to the value in the emap of the input key.
@@ -151,7 +447,11 @@ func (m *GenericEMap) AddIndex(key interface{}, index interface{}) error {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
-	return addIndex(m.keys, m.indices, key, index)
+	if m.closed {
+		return ErrClosed
+	}
+
+	return m.addIndex(key, index)
 }
 
 // RemoveIndex remove the input index from the value in the emap of the input key.
@@ -161,7 +461,17 @@ func (m *GenericEMap) RemoveIndex(key interface{}, index interface{}) error {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
-	return removeIndex(m.keys, m.indices, key, index)
+	if m.closed {
+		return ErrClosed
+	}
+
+	return m.removeIndex(key, index)
+}
+
+// Index returns the named index family of the emap, which has its own index storage scoped to the family.
+// The index family is created on the first index added to it, and the empty name means the default indices of the emap.
+func (m *GenericEMap) Index(name string) *IndexFamily[interface{}, interface{}, interface{}] {
+	return &IndexFamily[interface{}, interface{}, interface{}]{name: name, store: &m.store, locker: &m.mtx, closed: &m.closed}
 }
 
 // Check checks the internal storage consistency.
@@ -170,53 +480,54 @@ func (m *GenericEMap) check() error {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
-	if len(m.keys) != len(m.values) {
-		return errors.New("total key number not equal to total value number")
-	}
+	return check(m.values, m.keys, m.indices)
+}
+
+// Query returns a new query on the emap, e.g. m.Query().Where(Index("region", "eu")).Filter(predicate).Limit(50).Fetch().
+func (m *GenericEMap) Query() *Query {
+	return &Query{store: &m.store, locker: &m.mtx, closed: &m.closed}
+}
 
-	for key, indices := range m.keys {
-		if _, existed := m.values[key]; existed {
-			for _, index := range indices {
-				if keys, existed := m.indices[index]; existed {
-					found := false
-					for _, each := range keys {
-						if each == key {
-							found = true
-							break
-						}
-					}
-					if !found {
-						return errors.New("key storage is not consistent with index storage")
-					}
-				} else {
-					return errors.New("index not existed in the index storage")
-				}
-			}
-		} else {
-			return errors.New("key not existed in the value storage")
+// OnEvict registers the callback function which is called for each value removed from the emap,
+// with the key, value and indices of the removed value and the reason of the removal.
+// The callback function is called after the locker of the emap is released, so it may safely call back into the emap.
+// Only one callback function is kept, a later call replaces the former one.
+func (m *GenericEMap) OnEvict(callback func(key interface{}, value interface{}, indices []interface{}, reason EvictReason)) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.onEvict = callback
+}
+
+// Scan gets at most count key-value pairs in the order of insertion after the input cursor, 10 pairs if count is not positive.
+// Start a scan with cursor 0 and pass the returned cursor to the next call, until the returned cursor is 0 again.
+// The emap may be changed between the calls, and each value which exists during the whole scan is returned exactly once.
+func (m *GenericEMap) Scan(cursor uint64, count int) (pairs []KeyValue[interface{}, interface{}], next uint64, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
 		}
-	}
 
-	for index, keys := range m.indices {
-		for _, key := range keys {
-			if indices, existed := m.keys[key]; existed {
-				found := false
-				for _, each := range indices {
-					if each == index {
-						found = true
-						break
-					}
-				}
-				if !found {
-					return errors.New("index storage is not consistent with key storage")
-				}
-			} else {
-				return errors.New("key not existed in the key storage")
-			}
+		pairs, next = m.scan(cursor, count, now, stale)
+	})
+
+	return
+}
+
+// ScanIndex gets at most count key-value pairs of the input index like Scan.
+// Each value which has the input index during the whole scan is returned exactly once.
+func (m *GenericEMap) ScanIndex(index interface{}, cursor uint64, count int) (pairs []KeyValue[interface{}, interface{}], next uint64, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
 		}
-	}
 
-	return nil
+		pairs, next = m.scanIndex(index, cursor, count, now, stale)
+	})
+
+	return
 }
 
 // Transform is a higher-order operation which apply the input callback function to each key-value pair in the emap.
@@ -226,6 +537,10 @@ func (m *GenericEMap) Transform(callback func(interface{}, interface{}) (interfa
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
 
+	if m.closed {
+		return nil, ErrClosed
+	}
+
 	return transform(m.values, callback)
 }
 
@@ -233,8 +548,46 @@ func (m *GenericEMap) Transform(callback func(interface{}, interface{}) (interfa
 // Since the callback function has no return, the foreach procedure will never be interrupted.
 // A typical usage of Foreach is apply a closure.
 func (m *GenericEMap) Foreach(callback func(interface{}, interface{})) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		m.foreach(callback, now, stale)
+	})
+}
+
+// ForeachUntil applies the input callback function to each key-value pair in the emap until the callback function returns false.
+func (m *GenericEMap) ForeachUntil(callback func(interface{}, interface{}) bool) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		m.foreachUntil(callback, now, stale)
+	})
+}
+
+// ForeachErr applies the input callback function to each key-value pair in the emap.
+// Any error returned by the callback function will interrupt the procedure and the error will be returned.
+func (m *GenericEMap) ForeachErr(callback func(interface{}, interface{}) error) (err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		if m.closed {
+			err = ErrClosed
+			return
+		}
+
+		err = m.foreachErr(callback, now, stale)
+	})
+
+	return
+}
+
+// ForeachByIndex applies the input callback function to each key-value pair of the input index in the emap.
+// Only the keys of the input index are walked, and nothing is done for a non-existed index.
+func (m *GenericEMap) ForeachByIndex(index interface{}, callback func(interface{}, interface{})) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		m.foreachByIndex(index, callback, now, stale)
+	})
+}
+
+// Snapshot returns a consistent read-only view of the emap which can be read without holding the locker of the emap.
+// Taking a snapshot copies nothing without lazy expiration, but the next change of the emap copies its storage once, which costs O(n).
+func (m *GenericEMap) Snapshot() *Snapshot[interface{}, interface{}, interface{}] {
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
 
-	foreach(m.values, callback)
+	return m.snapshot(time.Now())
 }
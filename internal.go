@@ -11,9 +11,9 @@ import (
 	"errors"
 )
 
-func insert(valueStore map[interface{}]interface{}, keyStore map[interface{}][]interface{}, indexStore map[interface{}][]interface{}, key interface{}, value interface{}, indices ...interface{}) error {
+func insert[K comparable, V any, I comparable](valueStore map[K]V, keyStore map[K][]I, indexStore map[I][]K, key K, value V, indices ...I) error {
 	if _, exist := keyStore[key]; exist {
-		return errors.New("key duplicte")
+		return &KeyError{Key: key, Err: ErrKeyExists}
 	}
 
 	keyStore[key] = indices
@@ -23,39 +23,40 @@ func insert(valueStore map[interface{}]interface{}, keyStore map[interface{}][]i
 		if keys, exist := indexStore[index]; exist {
 			indexStore[index] = append(keys, key)
 		} else {
-			indexStore[index] = []interface{}{key}
+			indexStore[index] = []K{key}
 		}
 	}
 
 	return nil
 }
 
-func fetchByKey(valueStore map[interface{}]interface{}, key interface{}) (interface{}, error) {
+func fetchByKey[K comparable, V any](valueStore map[K]V, key K) (V, error) {
 	if value, exist := valueStore[key]; exist {
 		return value, nil
 	}
 
-	return nil, errors.New("key not exist")
+	var zero V
+	return zero, &KeyError{Key: key, Err: ErrKeyNotFound}
 }
 
-func fetchByIndex(valueStore map[interface{}]interface{}, indexStore map[interface{}][]interface{}, index interface{}) ([]interface{}, error) {
+func fetchByIndex[K comparable, V any, I comparable](valueStore map[K]V, indexStore map[I][]K, index I) ([]V, error) {
 	if keys, exist := indexStore[index]; exist {
-		values := make([]interface{}, len(keys))
+		values := make([]V, len(keys))
 		for i, key := range keys {
 			values[i] = valueStore[key]
 		}
 		return values, nil
 	}
 
-	return nil, errors.New("index not exist")
+	return nil, &IndexError{Index: index, Err: ErrIndexNotFound}
 }
 
-func deleteByKey(valueStore map[interface{}]interface{}, keyStore map[interface{}][]interface{}, indexStore map[interface{}][]interface{}, key interface{}) error {
+func deleteByKey[K comparable, V any, I comparable](valueStore map[K]V, keyStore map[K][]I, indexStore map[I][]K, key K) error {
 	if _, exist := keyStore[key]; !exist {
-		return errors.New("key not exist")
+		return &KeyError{Key: key, Err: ErrKeyNotFound}
 	}
 
-	indices := make([]interface{}, len(keyStore[key]))
+	indices := make([]I, len(keyStore[key]))
 	for i := range indices {
 		indices[i] = keyStore[key][i]
 	}
@@ -70,31 +71,14 @@ func deleteByKey(valueStore map[interface{}]interface{}, keyStore map[interface{
 	return nil
 }
 
-func deleteByIndex(valueStore map[interface{}]interface{}, keyStore map[interface{}][]interface{}, indexStore map[interface{}][]interface{}, index interface{}) error {
-	if _, exist := indexStore[index]; !exist {
-		return errors.New("index not exist")
-	}
-
-	keys := make([]interface{}, len(indexStore[index]))
-	for i := range keys {
-		keys[i] = indexStore[index][i]
-	}
-
-	for _, key := range keys {
-		deleteByKey(valueStore, keyStore, indexStore, key)
-	}
-
-	return nil
-}
-
-func addIndex(keyStore map[interface{}][]interface{}, indexStore map[interface{}][]interface{}, key interface{}, index interface{}) error {
+func addIndex[K comparable, I comparable](keyStore map[K][]I, indexStore map[I][]K, key K, index I) error {
 	if _, exist := keyStore[key]; !exist {
-		return errors.New("key not exist")
+		return &KeyError{Key: key, Err: ErrKeyNotFound}
 	}
 
 	for _, each := range keyStore[key] {
 		if each == index {
-			return errors.New("index duplicte")
+			return &IndexError{Index: index, Err: ErrIndexExists}
 		}
 	}
 	keyStore[key] = append(keyStore[key], index)
@@ -102,19 +86,19 @@ func addIndex(keyStore map[interface{}][]interface{}, indexStore map[interface{}
 	if keys, exist := indexStore[index]; exist {
 		indexStore[index] = append(keys, key)
 	} else {
-		indexStore[index] = []interface{}{key}
+		indexStore[index] = []K{key}
 	}
 
 	return nil
 }
 
-func removeIndex(keyStore map[interface{}][]interface{}, indexStore map[interface{}][]interface{}, key interface{}, index interface{}) error {
+func removeIndex[K comparable, I comparable](keyStore map[K][]I, indexStore map[I][]K, key K, index I) error {
 	if _, exist := keyStore[key]; !exist {
-		return errors.New("key not exist")
+		return &KeyError{Key: key, Err: ErrKeyNotFound}
 	}
 
 	if _, exist := indexStore[index]; !exist {
-		return errors.New("index not exist")
+		return &IndexError{Index: index, Err: ErrIndexNotFound}
 	}
 
 	for i, each := range keyStore[key] {
@@ -145,9 +129,59 @@ func removeIndex(keyStore map[interface{}][]interface{}, indexStore map[interfac
 	return nil
 }
 
-func transform(valueStore map[interface{}]interface{}, callback func(interface{}, interface{}) (interface{}, error)) (map[interface{}]interface{}, error) {
+func check[K comparable, V any, I comparable](valueStore map[K]V, keyStore map[K][]I, indexStore map[I][]K) error {
+	if len(keyStore) != len(valueStore) {
+		return errors.New("total key number not equal to total value number")
+	}
+
+	for key, indices := range keyStore {
+		if _, existed := valueStore[key]; existed {
+			for _, index := range indices {
+				if keys, existed := indexStore[index]; existed {
+					found := false
+					for _, each := range keys {
+						if each == key {
+							found = true
+							break
+						}
+					}
+					if !found {
+						return errors.New("key storage is not consistent with index storage")
+					}
+				} else {
+					return errors.New("index not existed in the index storage")
+				}
+			}
+		} else {
+			return errors.New("key not existed in the value storage")
+		}
+	}
+
+	for index, keys := range indexStore {
+		for _, key := range keys {
+			if indices, existed := keyStore[key]; existed {
+				found := false
+				for _, each := range indices {
+					if each == index {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return errors.New("index storage is not consistent with key storage")
+				}
+			} else {
+				return errors.New("key not existed in the key storage")
+			}
+		}
+	}
+
+	return nil
+}
+
+func transform[K comparable, V any, T any](valueStore map[K]V, callback func(K, V) (T, error)) (map[K]T, error) {
 	var err error
-	targets := make(map[interface{}]interface{}, len(valueStore))
+	targets := make(map[K]T, len(valueStore))
 
 	for key, value := range valueStore {
 		targets[key], err = callback(key, value)
@@ -159,8 +193,16 @@ func transform(valueStore map[interface{}]interface{}, callback func(interface{}
 	return targets, nil
 }
 
-func foreach(valueStore map[interface{}]interface{}, callback func(interface{}, interface{})) {
+func foreach[K comparable, V any](valueStore map[K]V, callback func(K, V)) {
 	for key, value := range valueStore {
 		callback(key, value)
 	}
 }
+
+func foreachUntil[K comparable, V any](valueStore map[K]V, callback func(K, V) bool) {
+	for key, value := range valueStore {
+		if !callback(key, value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+//go:build go1.23
+
+package emap
+
+import (
+	"iter"
+	"reflect"
+	"time"
+)
+
+// All returns an iterator over the key-value pairs in the snapshot.
+func (s *Snapshot[K, V, I]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for key, value := range s.values {
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over the keys in the snapshot.
+func (s *Snapshot[K, V, I]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range s.values {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// Indices returns an iterator over the indices in the snapshot.
+func (s *Snapshot[K, V, I]) Indices() iter.Seq[I] {
+	return func(yield func(I) bool) {
+		for index := range s.indices {
+			if !yield(index) {
+				return
+			}
+		}
+	}
+}
+
+// ValuesByIndex returns an iterator over the values of the input index in the snapshot.
+func (s *Snapshot[K, V, I]) ValuesByIndex(index I) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, key := range s.indices[index] {
+			if !yield(s.values[key]) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over the key-value pairs in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+func (m *GenericEMap) All() iter.Seq2[interface{}, interface{}] {
+	return func(yield func(interface{}, interface{}) bool) {
+		m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+			m.all(now, stale)(yield)
+		})
+	}
+}
+
+// Keys returns an iterator over the keys in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+func (m *GenericEMap) Keys() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+			m.keysSeq(now, stale)(yield)
+		})
+	}
+}
+
+// Indices returns an iterator over the indices in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+func (m *GenericEMap) Indices() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+			m.indicesSeq(now, stale)(yield)
+		})
+	}
+}
+
+// ValuesByIndex returns an iterator over the values of the input index in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+func (m *GenericEMap) ValuesByIndex(index interface{}) iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+			m.valuesByIndex(index, now, stale)(yield)
+		})
+	}
+}
+
+// All returns an iterator over the key-value pairs in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+func (m *StrictEMap) All() iter.Seq2[interface{}, interface{}] {
+	return func(yield func(interface{}, interface{}) bool) {
+		m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+			m.all(now, stale)(yield)
+		})
+	}
+}
+
+// Keys returns an iterator over the keys in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+func (m *StrictEMap) Keys() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+			m.keysSeq(now, stale)(yield)
+		})
+	}
+}
+
+// Indices returns an iterator over the indices in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+func (m *StrictEMap) Indices() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+			m.indicesSeq(now, stale)(yield)
+		})
+	}
+}
+
+// ValuesByIndex returns an iterator over the values of the input index in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+// An index of a mismatched type yields nothing.
+func (m *StrictEMap) ValuesByIndex(index interface{}) iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		if m.indexType != reflect.TypeOf(index).Kind() {
+			return
+		}
+
+		m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+			m.valuesByIndex(index, now, stale)(yield)
+		})
+	}
+}
+
+// All returns an iterator over the key-value pairs in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+func (m *TypedEMap[K, V, I]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.read(&m.mtx, func(now time.Time, stale *[]K) {
+			m.all(now, stale)(yield)
+		})
+	}
+}
+
+// Keys returns an iterator over the keys in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+func (m *TypedEMap[K, V, I]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.read(&m.mtx, func(now time.Time, stale *[]K) {
+			m.keysSeq(now, stale)(yield)
+		})
+	}
+}
+
+// Indices returns an iterator over the indices in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+func (m *TypedEMap[K, V, I]) Indices() iter.Seq[I] {
+	return func(yield func(I) bool) {
+		m.read(&m.mtx, func(now time.Time, stale *[]K) {
+			m.indicesSeq(now, stale)(yield)
+		})
+	}
+}
+
+// ValuesByIndex returns an iterator over the values of the input index in the emap.
+// The loop runs with the read locker of the emap held, so the loop body must not call back into the emap.
+// Range over a Snapshot instead if the loop body needs to change the emap.
+func (m *TypedEMap[K, V, I]) ValuesByIndex(index I) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.read(&m.mtx, func(now time.Time, stale *[]K) {
+			m.valuesByIndex(index, now, stale)(yield)
+		})
+	}
+}
+
+// All returns an iterator over the key-value pairs in the emap.
+// The loop body may change the emap, a value deleted before it is reached is not yielded.
+func (m *UnlockEMap) All() iter.Seq2[interface{}, interface{}] {
+	return func(yield func(interface{}, interface{}) bool) {
+		m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+			m.all(now, stale)(yield)
+		})
+	}
+}
+
+// Keys returns an iterator over the keys in the emap.
+// The loop body may change the emap, a key deleted before it is reached is not yielded.
+func (m *UnlockEMap) Keys() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+			m.keysSeq(now, stale)(yield)
+		})
+	}
+}
+
+// Indices returns an iterator over the indices in the emap.
+// The loop body may change the emap, an index removed before it is reached is not yielded.
+func (m *UnlockEMap) Indices() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+			m.indicesSeq(now, stale)(yield)
+		})
+	}
+}
+
+// ValuesByIndex returns an iterator over the values of the input index in the emap.
+// The loop body may change the emap, a value deleted before it is reached is not yielded.
+func (m *UnlockEMap) ValuesByIndex(index interface{}) iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+			m.valuesByIndex(index, now, stale)(yield)
+		})
+	}
+}
+
+// All returns an iterator over the key-value pairs in the emap.
+// The loop body may change the emap, a value deleted before it is reached is not yielded.
+func (m *TypedUnlockEMap[K, V, I]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+			m.all(now, stale)(yield)
+		})
+	}
+}
+
+// Keys returns an iterator over the keys in the emap.
+// The loop body may change the emap, a key deleted before it is reached is not yielded.
+func (m *TypedUnlockEMap[K, V, I]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+			m.keysSeq(now, stale)(yield)
+		})
+	}
+}
+
+// Indices returns an iterator over the indices in the emap.
+// The loop body may change the emap, an index removed before it is reached is not yielded.
+func (m *TypedUnlockEMap[K, V, I]) Indices() iter.Seq[I] {
+	return func(yield func(I) bool) {
+		m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+			m.indicesSeq(now, stale)(yield)
+		})
+	}
+}
+
+// ValuesByIndex returns an iterator over the values of the input index in the emap.
+// The loop body may change the emap, a value deleted before it is reached is not yielded.
+func (m *TypedUnlockEMap[K, V, I]) ValuesByIndex(index I) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+			m.valuesByIndex(index, now, stale)(yield)
+		})
+	}
+}
+
+// all returns an iterator over the alive key-value pairs in the store without any locker.
+// The expired keys found are appended to stale.
+func (s *store[K, V, I]) all(now time.Time, stale *[]K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for key := range s.values {
+			if s.alive(key, now, stale) && !yield(key, s.values[key]) {
+				return
+			}
+		}
+	}
+}
+
+func (s *store[K, V, I]) keysSeq(now time.Time, stale *[]K) iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range s.all(now, stale) {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+func (s *store[K, V, I]) indicesSeq(now time.Time, stale *[]K) iter.Seq[I] {
+	return func(yield func(I) bool) {
+		for index := range s.indices {
+			if s.keyNumOfIndex(index, now, stale) > 0 && !yield(index) {
+				return
+			}
+		}
+	}
+}
+
+// valuesByIndex iterates over a copy of the posting list, so the posting list may be changed by the loop body of an unlock emap.
+func (s *store[K, V, I]) valuesByIndex(index I, now time.Time, stale *[]K) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, key := range append([]K(nil), s.indices[index]...) {
+			if s.alive(key, now, stale) && contains(s.keys[key], index) && !yield(s.values[key]) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+//go:build go1.23
+
+package emap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("Tests of emap iterators", func() {
+	Context("range over func", func() {
+		It("Given a generic emap, when range over its iterators, it should yield all the pairs and stop on break.", func() {
+			emap := NewGenericEMap()
+			emap.Insert("key1", 1, "index1")
+			emap.Insert("key2", 2, "index1", "index2")
+			emap.Insert("key3", 3)
+
+			pairs := make(map[interface{}]interface{})
+			for key, value := range emap.All() {
+				pairs[key] = value
+			}
+			Expect(pairs).To(Equal(map[interface{}]interface{}{"key1": 1, "key2": 2, "key3": 3}))
+
+			num := 0
+			for range emap.Keys() {
+				num++
+				break
+			}
+			Expect(num).To(Equal(1))
+
+			var indices []interface{}
+			for index := range emap.Indices() {
+				indices = append(indices, index)
+			}
+			Expect(indices).To(ConsistOf("index1", "index2"))
+
+			var values []interface{}
+			for value := range emap.ValuesByIndex("index1") {
+				values = append(values, value)
+			}
+			Expect(values).To(Equal([]interface{}{1, 2}))
+		})
+
+		It("Given a locked emap, when the loop breaks or panics, it should release the read locker.", func() {
+			emap := NewTypedEMap[string, int, string]()
+			emap.Insert("key1", 1, "index1")
+			emap.Insert("key2", 2, "index1")
+
+			for range emap.ValuesByIndex("index1") {
+				break
+			}
+			Expect(func() {
+				for range emap.All() {
+					panic("loop body")
+				}
+			}).To(Panic())
+
+			for key := range emap.Snapshot().Keys() {
+				emap.DeleteByKey(key)
+				emap.Insert(key+"0", 0)
+			}
+			Expect(emap.KeyNum()).To(Equal(2))
+			Expect(emap.HasIndex("index1")).To(Equal(false))
+		})
+
+		It("Given an unlock emap, when the loop body deletes values, it should not yield the deleted values.", func() {
+			emap := NewTypedUnlockEMap[int, int, string]()
+			for i := 0; i < 10; i++ {
+				emap.Insert(i, i, "index")
+			}
+
+			num := 0
+			for value := range emap.ValuesByIndex("index") {
+				num++
+				emap.DeleteByKey(value + 1)
+			}
+			Expect(num).To(Equal(5))
+
+			num = 0
+			for key := range emap.All() {
+				Expect(emap.HasKey(key)).To(Equal(true))
+				emap.DeleteByKey(key)
+				num++
+			}
+			Expect(num).To(Equal(5))
+			Expect(emap.KeyNum()).To(Equal(0))
+		})
+
+		It("Given an emap with lazy expiration, when range over its iterators, it should leave out the expired values.", func() {
+			emap := NewUnlockEMap(WithTTL(50*time.Millisecond), WithLazyExpiration(false))
+			emap.Insert("key1", 1, "index1")
+			time.Sleep(100 * time.Millisecond)
+			emap.Insert("key2", 2, "index2")
+
+			var keys []interface{}
+			for key := range emap.Keys() {
+				keys = append(keys, key)
+			}
+			Expect(keys).To(Equal([]interface{}{"key2"}))
+			for range emap.Indices() {
+				keys = append(keys, nil)
+			}
+			Expect(keys).To(HaveLen(2))
+		})
+	})
+})
@@ -0,0 +1,46 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"time"
+)
+
+// WithLazyExpiration makes the read operations of an expirable emap treat the expired values as absent,
+// so no expired value is returned between two checks of the expiration checker regardless of the interval.
+// The read operations are FetchByKey, FetchByIndex, HasKey, HasIndex, KeyNumOfIndex and Foreach.
+// If purge is true, the expired values found by the read operations are deleted on the spot.
+func WithLazyExpiration(purge bool) Option {
+	return func(c *config) {
+		c.lazy = true
+		c.purge = purge
+	}
+}
+
+func (s *store[K, V, I]) isExpired(key K, value V, now time.Time) bool {
+	if d, exist := s.deadlines[key]; exist && !now.Before(d.expiry()) {
+		return true
+	}
+
+	if s.expirables.has(key) {
+		return any(value).(ExpirableValue).IsExpired()
+	}
+
+	return false
+}
+
+// alive returns if the input key exists and is not expired.
+// An expired key is appended to stale.
+func (s *store[K, V, I]) alive(key K, now time.Time, stale *[]K) bool {
+	value, exist := s.values[key]
+	if !exist {
+		return false
+	}
+
+	if s.lazy && s.isExpired(key, value, now) {
+		*stale = append(*stale, key)
+		return false
+	}
+
+	return true
+}
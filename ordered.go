@@ -0,0 +1,214 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	maxSkiplistLevel = 32
+	skiplistP        = 4 // a node has a level more with the probability of 1/skiplistP
+)
+
+// Comparator compares two indices, returns a negative number if a < b, zero if a == b and a positive number if a > b.
+type Comparator func(a, b interface{}) int
+
+// WithOrderedIndex keeps the indices of the emap ordered by the input comparator,
+// which enables FetchByIndexRange, Min, Max, Ascend and Descend.
+// The equality operations such as FetchByIndex are not changed and still cost O(1),
+// while adding a new index or removing the last key of an index costs O(log n) more.
+func WithOrderedIndex(compare Comparator) Option {
+	return func(c *config) {
+		c.compare = compare
+	}
+}
+
+// skiplist keeps the distinct indices ordered by the comparator.
+type skiplist[I comparable] struct {
+	compare Comparator
+	head    *skipnode[I] // sentinel node without index
+	tail    *skipnode[I] // last node, nil if the skiplist is empty
+	level   int
+}
+
+type skipnode[I comparable] struct {
+	index I
+	next  []*skipnode[I]
+	prev  *skipnode[I] // previous node in the lowest level, nil for the first node
+}
+
+func newSkiplist[I comparable](compare Comparator) *skiplist[I] {
+	return &skiplist[I]{compare: compare, head: &skipnode[I]{next: make([]*skipnode[I], maxSkiplistLevel)}, level: 1}
+}
+
+func (l *skiplist[I]) less(a, b I) bool {
+	return l.compare(a, b) < 0
+}
+
+// path returns the last node before the input index in each level.
+func (l *skiplist[I]) path(index I) [maxSkiplistLevel]*skipnode[I] {
+	var path [maxSkiplistLevel]*skipnode[I]
+	node := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && l.less(node.next[i].index, index) {
+			node = node.next[i]
+		}
+		path[i] = node
+	}
+
+	return path
+}
+
+func (l *skiplist[I]) insert(index I) {
+	path := l.path(index)
+	if next := path[0].next[0]; next != nil && l.compare(next.index, index) == 0 {
+		return
+	}
+
+	level := 1
+	for level < maxSkiplistLevel && rand.Intn(skiplistP) == 0 {
+		level++
+	}
+	for ; l.level < level; l.level++ {
+		path[l.level] = l.head
+	}
+
+	node := &skipnode[I]{index: index, next: make([]*skipnode[I], level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = path[i].next[i]
+		path[i].next[i] = node
+	}
+	if path[0] != l.head {
+		node.prev = path[0]
+	}
+	if node.next[0] != nil {
+		node.next[0].prev = node
+	} else {
+		l.tail = node
+	}
+}
+
+func (l *skiplist[I]) remove(index I) {
+	path := l.path(index)
+	node := path[0].next[0]
+	if node == nil || l.compare(node.index, index) != 0 {
+		return
+	}
+
+	for i := range node.next {
+		path[i].next[i] = node.next[i]
+	}
+	if node.next[0] != nil {
+		node.next[0].prev = node.prev
+	} else {
+		l.tail = node.prev
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+}
+
+// seek returns the first node not less than the input index, nil if there is none.
+func (l *skiplist[I]) seek(index I) *skipnode[I] {
+	return l.path(index)[0].next[0]
+}
+
+func (l *skiplist[I]) first() *skipnode[I] {
+	return l.head.next[0]
+}
+
+func (l *skiplist[I]) last() *skipnode[I] {
+	return l.tail
+}
+
+// order keeps the ordered indices in step with the index storage after the input indices are changed.
+func (s *store[K, V, I]) order(indices ...I) {
+	if s.ordered == nil {
+		return
+	}
+
+	for _, index := range indices {
+		if _, exist := s.indices[index]; exist {
+			s.ordered.insert(index)
+		} else {
+			s.ordered.remove(index)
+		}
+	}
+}
+
+// fetchByIndexRange gets the values of the indices between lo and hi inclusively in the ascending order of the indices.
+// A value having more than one index in the range is returned only once.
+func (s *store[K, V, I]) fetchByIndexRange(lo, hi I, now time.Time, stale *[]K) ([]V, error) {
+	if s.ordered == nil {
+		return nil, ErrUnordered
+	}
+
+	var values []V
+	seen := make(map[K]struct{})
+	for node := s.ordered.seek(lo); node != nil && !s.ordered.less(hi, node.index); node = node.next[0] {
+		for _, key := range s.indices[node.index] {
+			if _, exist := seen[key]; exist || !s.alive(key, now, stale) {
+				continue
+			}
+			seen[key] = struct{}{}
+			s.accessed(key, now)
+			values = append(values, s.values[key])
+		}
+	}
+
+	return values, nil
+}
+
+// edge gets the smallest index with its values, or the largest one if descending.
+func (s *store[K, V, I]) edge(descending bool, now time.Time, stale *[]K) (index I, values []V, err error) {
+	if s.ordered == nil {
+		return index, nil, ErrUnordered
+	}
+
+	for node := s.start(descending); node != nil; node = step(node, descending) {
+		if values, err = s.fetchByIndex(node.index, now, stale); err == nil {
+			return node.index, values, nil
+		}
+	}
+
+	return index, nil, &IndexError{Index: index, Err: ErrIndexNotFound}
+}
+
+// walk applies the input callback function to each index-value pair in the order of the indices until it returns false.
+func (s *store[K, V, I]) walk(descending bool, callback func(I, V) bool, now time.Time, stale *[]K) error {
+	if s.ordered == nil {
+		return ErrUnordered
+	}
+
+	for node := s.start(descending); node != nil; node = step(node, descending) {
+		for _, key := range s.indices[node.index] {
+			if !s.alive(key, now, stale) {
+				continue
+			}
+			s.accessed(key, now)
+			if !callback(node.index, s.values[key]) {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *store[K, V, I]) start(descending bool) *skipnode[I] {
+	if descending {
+		return s.ordered.last()
+	}
+
+	return s.ordered.first()
+}
+
+func step[I comparable](node *skipnode[I], descending bool) *skipnode[I] {
+	if descending {
+		return node.prev
+	}
+
+	return node.next[0]
+}
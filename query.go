@@ -0,0 +1,304 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"time"
+)
+
+// anyStore is the store embedded by the generic, strict and unlock emaps.
+type anyStore = store[interface{}, interface{}, interface{}]
+
+// Condition is a condition on the keys and indices of a query, created by Index, Keys, AnyOf and NoneOf.
+type Condition interface {
+	// estimate returns the number of the candidate keys, or -1 if the condition can not list its candidates.
+	estimate(s *anyStore) int
+	// candidates lists the keys which may match the condition.
+	candidates(s *anyStore) []interface{}
+	// match returns if the input existing key matches the condition.
+	match(s *anyStore, key interface{}) bool
+	// check checks the types of the keys and indices of the condition.
+	check(c checker[interface{}, interface{}, interface{}]) error
+}
+
+// Index matches the keys having the input index in the named index family, the empty name means the default indices.
+func Index(family string, index interface{}) Condition {
+	return &indexCondition{family, index}
+}
+
+// Keys matches the input keys.
+func Keys(keys ...interface{}) Condition {
+	var unique []interface{}
+	for _, key := range keys {
+		if !contains(unique, key) {
+			unique = append(unique, key)
+		}
+	}
+
+	return &keysCondition{unique}
+}
+
+// AnyOf matches the keys matching any of the input conditions.
+func AnyOf(conditions ...Condition) Condition {
+	return &anyCondition{conditions}
+}
+
+// NoneOf matches the keys matching none of the input conditions.
+// It can not list its candidates, so a query with only NoneOf conditions scans all the values.
+func NoneOf(conditions ...Condition) Condition {
+	return &noneCondition{conditions}
+}
+
+type indexCondition struct {
+	family string
+	index  interface{}
+}
+
+func (c *indexCondition) estimate(s *anyStore) int {
+	return len(s.familyIndices(c.family)[c.index])
+}
+
+func (c *indexCondition) candidates(s *anyStore) []interface{} {
+	return s.familyIndices(c.family)[c.index]
+}
+
+func (c *indexCondition) match(s *anyStore, key interface{}) bool {
+	if c.family == "" {
+		return contains(s.keys[key], c.index)
+	}
+
+	if f, exist := s.families[c.family]; exist {
+		return contains(f.keys[key], c.index)
+	}
+
+	return false
+}
+
+func (c *indexCondition) check(checker checker[interface{}, interface{}, interface{}]) error {
+	return checker.checkIndex(c.index)
+}
+
+type keysCondition struct {
+	keys []interface{}
+}
+
+func (c *keysCondition) estimate(s *anyStore) int {
+	return len(c.keys)
+}
+
+func (c *keysCondition) candidates(s *anyStore) []interface{} {
+	return c.keys
+}
+
+func (c *keysCondition) match(s *anyStore, key interface{}) bool {
+	return contains(c.keys, key)
+}
+
+func (c *keysCondition) check(checker checker[interface{}, interface{}, interface{}]) error {
+	for _, key := range c.keys {
+		if err := checker.checkKey(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type anyCondition struct {
+	conditions []Condition
+}
+
+func (c *anyCondition) estimate(s *anyStore) int {
+	total := 0
+	for _, condition := range c.conditions {
+		num := condition.estimate(s)
+		if num < 0 {
+			return -1
+		}
+		total += num
+	}
+
+	return total
+}
+
+func (c *anyCondition) candidates(s *anyStore) []interface{} {
+	var keys []interface{}
+	seen := make(map[interface{}]struct{})
+	for _, condition := range c.conditions {
+		for _, key := range condition.candidates(s) {
+			if _, exist := seen[key]; !exist {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys
+}
+
+func (c *anyCondition) match(s *anyStore, key interface{}) bool {
+	for _, condition := range c.conditions {
+		if condition.match(s, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *anyCondition) check(checker checker[interface{}, interface{}, interface{}]) error {
+	return checkAll(checker, c.conditions)
+}
+
+type noneCondition struct {
+	conditions []Condition
+}
+
+func (c *noneCondition) estimate(s *anyStore) int {
+	return -1
+}
+
+func (c *noneCondition) candidates(s *anyStore) []interface{} {
+	return nil
+}
+
+func (c *noneCondition) match(s *anyStore, key interface{}) bool {
+	for _, condition := range c.conditions {
+		if condition.match(s, key) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *noneCondition) check(checker checker[interface{}, interface{}, interface{}]) error {
+	return checkAll(checker, c.conditions)
+}
+
+func checkAll(checker checker[interface{}, interface{}, interface{}], conditions []Condition) error {
+	for _, condition := range conditions {
+		if err := condition.check(checker); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Query is a query on the keys, indices and values of an emap returned by the Query method of the emap.
+// All the conditions added by Where and And must be matched, then the values are filtered by the predicates of Filter.
+// When the query is fetched, the condition with the fewest candidate keys in the index storage is chosen to drive the query,
+// and the other conditions are checked on each candidate key,
+// the values are scanned only if none of the conditions can list its candidates.
+// A query is not concurrent safe itself, but it can be fetched again after the emap is changed.
+type Query struct {
+	store      *anyStore
+	locker     locker
+	closed     *bool                                          // nil if the emap can not be closed
+	checker    checker[interface{}, interface{}, interface{}] // nil unless the emap is a strict emap
+	conditions []Condition
+	filters    []func(key interface{}, value interface{}) bool
+	limit      int
+}
+
+// Where adds a condition to the query.
+func (q *Query) Where(condition Condition) *Query {
+	q.conditions = append(q.conditions, condition)
+	return q
+}
+
+// And adds one more condition to the query, all the conditions must be matched.
+func (q *Query) And(condition Condition) *Query {
+	return q.Where(condition)
+}
+
+// Filter adds a predicate on the key-value pairs matching the conditions.
+// The predicate is called with the read locker of the emap held, so it must not call back into the emap.
+func (q *Query) Filter(predicate func(key interface{}, value interface{}) bool) *Query {
+	q.filters = append(q.filters, predicate)
+	return q
+}
+
+// Limit limits the number of the key-value pairs fetched by the query, 0 means unlimited.
+func (q *Query) Limit(limit int) *Query {
+	q.limit = limit
+	return q
+}
+
+// Fetch runs the query and returns the matched key-value pairs.
+// The pairs are in the order of the posting list driving the query, or in no particular order if the values are scanned.
+// Try to fetch without any match will return no pair without error.
+func (q *Query) Fetch() (pairs []KeyValue[interface{}, interface{}], err error) {
+	if q.checker != nil {
+		if err = checkAll(q.checker, q.conditions); err != nil {
+			return nil, err
+		}
+	}
+
+	q.store.read(q.locker, func(now time.Time, stale *[]interface{}) {
+		if q.closed != nil && *q.closed {
+			err = ErrClosed
+			return
+		}
+
+		pairs = q.run(now, stale)
+	})
+
+	return
+}
+
+// plan chooses the condition with the fewest candidate keys, -1 if none of the conditions can list its candidates.
+func (q *Query) plan() int {
+	driver, fewest := -1, 0
+	for i, condition := range q.conditions {
+		if num := condition.estimate(q.store); num >= 0 && (driver < 0 || num < fewest) {
+			driver, fewest = i, num
+		}
+	}
+
+	return driver
+}
+
+func (q *Query) run(now time.Time, stale *[]interface{}) []KeyValue[interface{}, interface{}] {
+	var pairs []KeyValue[interface{}, interface{}]
+	visit := func(key interface{}, skip int) bool {
+		if _, exist := q.store.keys[key]; !exist {
+			return true
+		}
+		for i, condition := range q.conditions {
+			if i != skip && !condition.match(q.store, key) {
+				return true
+			}
+		}
+		if !q.store.alive(key, now, stale) {
+			return true
+		}
+		for _, filter := range q.filters {
+			if !filter(key, q.store.values[key]) {
+				return true
+			}
+		}
+
+		pairs = append(pairs, q.store.pair(key, now))
+		return q.limit <= 0 || len(pairs) < q.limit
+	}
+
+	driver := q.plan()
+	if driver < 0 {
+		for key := range q.store.values {
+			if !visit(key, -1) {
+				break
+			}
+		}
+		return pairs
+	}
+
+	for _, key := range q.conditions[driver].candidates(q.store) {
+		if !visit(key, driver) {
+			break
+		}
+	}
+
+	return pairs
+}
@@ -0,0 +1,103 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	defaultScanCount = 10
+	minCompaction    = 64 // min number of the deleted keys in the scan log before it is compacted
+)
+
+// scanEntry is a key in the scan log with the serial number given when it is inserted.
+// The entry is deleted if the serial number of the key is changed or removed.
+type scanEntry[K comparable] struct {
+	serial uint64
+	key    K
+}
+
+// enlist gives the next serial number to the input key which is just inserted and appends it to the scan log.
+func (s *store[K, V, I]) enlist(key K) {
+	s.serial++
+	s.serials[key] = s.serial
+	s.scanLog = append(s.scanLog, scanEntry[K]{s.serial, key})
+}
+
+// delist removes the serial number of the input key which is just deleted,
+// and compacts the scan log if more than half of its entries are deleted.
+// The scan log is never compacted in a transaction, since a rollback may bring the deleted entries back.
+func (s *store[K, V, I]) delist(key K) {
+	delete(s.serials, key)
+
+	deleted := len(s.scanLog) - len(s.serials)
+	if s.journal != nil || deleted < minCompaction || deleted < len(s.serials) {
+		return
+	}
+
+	log := make([]scanEntry[K], 0, len(s.serials))
+	for _, entry := range s.scanLog {
+		if s.serials[entry.key] == entry.serial {
+			log = append(log, entry)
+		}
+	}
+	s.scanLog = log
+}
+
+// scan gets at most count key-value pairs inserted after the cursor in the order of insertion.
+// The returned cursor is the serial number of the last pair, or 0 if there is no more pair to scan.
+func (s *store[K, V, I]) scan(cursor uint64, count int, now time.Time, stale *[]K) ([]KeyValue[K, V], uint64) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	var pairs []KeyValue[K, V]
+	start := sort.Search(len(s.scanLog), func(i int) bool {
+		return s.scanLog[i].serial > cursor
+	})
+	for _, entry := range s.scanLog[start:] {
+		if s.serials[entry.key] != entry.serial || !s.alive(entry.key, now, stale) {
+			continue
+		}
+		if len(pairs) == count {
+			return pairs, cursor
+		}
+
+		pairs = append(pairs, KeyValue[K, V]{entry.key, s.values[entry.key]})
+		cursor = entry.serial
+	}
+
+	return pairs, 0
+}
+
+// scanIndex gets at most count key-value pairs of the input index inserted after the cursor in the order of insertion.
+// The returned cursor is the serial number of the last pair, or 0 if there is no more pair to scan.
+func (s *store[K, V, I]) scanIndex(index I, cursor uint64, count int, now time.Time, stale *[]K) ([]KeyValue[K, V], uint64) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	var entries []scanEntry[K]
+	for _, key := range s.indices[index] {
+		if serial := s.serials[key]; serial > cursor && s.alive(key, now, stale) {
+			entries = append(entries, scanEntry[K]{serial, key})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].serial < entries[j].serial
+	})
+
+	var pairs []KeyValue[K, V]
+	for _, entry := range entries {
+		if len(pairs) == count {
+			return pairs, cursor
+		}
+
+		pairs = append(pairs, KeyValue[K, V]{entry.key, s.values[entry.key]})
+		cursor = entry.serial
+	}
+
+	return pairs, 0
+}
@@ -0,0 +1,93 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"time"
+)
+
+// KeyValue is a key-value pair in the emap returned by the queries across indices.
+type KeyValue[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// fetchByAllIndices gets the key-value pairs having all the input indices.
+// The posting list of the index with the fewest keys is walked, and each key is checked against the other indices.
+func (s *store[K, V, I]) fetchByAllIndices(indices []I, now time.Time, stale *[]K) []KeyValue[K, V] {
+	if len(indices) == 0 {
+		return nil
+	}
+
+	smallest := indices[0]
+	for _, index := range indices[1:] {
+		if len(s.indices[index]) < len(s.indices[smallest]) {
+			smallest = index
+		}
+	}
+
+	var pairs []KeyValue[K, V]
+	for _, key := range s.indices[smallest] {
+		if s.hasAll(key, indices) && s.alive(key, now, stale) {
+			pairs = append(pairs, s.pair(key, now))
+		}
+	}
+
+	return pairs
+}
+
+// fetchByAnyIndex gets the key-value pairs having any of the input indices, each key is returned only once.
+func (s *store[K, V, I]) fetchByAnyIndex(indices []I, now time.Time, stale *[]K) []KeyValue[K, V] {
+	var pairs []KeyValue[K, V]
+	seen := make(map[K]struct{})
+	for _, index := range indices {
+		for _, key := range s.indices[index] {
+			if _, exist := seen[key]; exist || !s.alive(key, now, stale) {
+				continue
+			}
+			seen[key] = struct{}{}
+			pairs = append(pairs, s.pair(key, now))
+		}
+	}
+
+	return pairs
+}
+
+// fetchExcept gets the key-value pairs having the input index but none of the excluded indices.
+func (s *store[K, V, I]) fetchExcept(index I, excluded []I, now time.Time, stale *[]K) []KeyValue[K, V] {
+	var pairs []KeyValue[K, V]
+	for _, key := range s.indices[index] {
+		if !s.hasAny(key, excluded) && s.alive(key, now, stale) {
+			pairs = append(pairs, s.pair(key, now))
+		}
+	}
+
+	return pairs
+}
+
+func (s *store[K, V, I]) hasAll(key K, indices []I) bool {
+	for _, index := range indices {
+		if !contains(s.keys[key], index) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *store[K, V, I]) hasAny(key K, indices []I) bool {
+	for _, index := range indices {
+		if contains(s.keys[key], index) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pair returns the key-value pair of the input alive key and records the access to it.
+func (s *store[K, V, I]) pair(key K, now time.Time) KeyValue[K, V] {
+	s.accessed(key, now)
+
+	return KeyValue[K, V]{key, s.values[key]}
+}
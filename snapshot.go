@@ -0,0 +1,140 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"time"
+)
+
+// Snapshot is a consistent read-only view of an emap at the time it is taken.
+// It is read without holding the locker of the emap, so slow readers of a snapshot never block the writers of the emap.
+// Taking a snapshot is copy-on-write: the snapshot shares the storage of the emap,
+// and the next change of the emap copies the whole storage once with the write locker held, which costs O(n).
+// So taking a snapshot after each write doubles the cost of the writes, while reading many snapshots of a stable emap is cheap.
+// A snapshot is immutable and safe for concurrent use, while the values themselves are shared with the emap but not copied.
+// Reading a snapshot neither refreshes the sliding expiration nor counts as a use for the evict policy.
+type Snapshot[K comparable, V any, I comparable] struct {
+	version uint64
+	values  map[K]V
+	keys    map[K][]I
+	indices map[I][]K
+}
+
+// KeyNum returns the total key number in the snapshot.
+func (s *Snapshot[K, V, I]) KeyNum() int {
+	return len(s.keys)
+}
+
+// KeyNumOfIndex returns the total key number of the input index in the snapshot.
+func (s *Snapshot[K, V, I]) KeyNumOfIndex(index I) int {
+	return len(s.indices[index])
+}
+
+// IndexNum returns the total index number in the snapshot.
+func (s *Snapshot[K, V, I]) IndexNum() int {
+	return len(s.indices)
+}
+
+// IndexNumOfKey returns the total index number of the input key in the snapshot.
+func (s *Snapshot[K, V, I]) IndexNumOfKey(key K) int {
+	return len(s.keys[key])
+}
+
+// HasKey returns if the input key exists in the snapshot.
+func (s *Snapshot[K, V, I]) HasKey(key K) bool {
+	_, exist := s.keys[key]
+	return exist
+}
+
+// HasIndex returns if the input index exists in the snapshot.
+func (s *Snapshot[K, V, I]) HasIndex(index I) bool {
+	_, exist := s.indices[index]
+	return exist
+}
+
+// FetchByKey gets the value in the snapshot by input key.
+// Try to fetch a non-existed key will cause an error return.
+func (s *Snapshot[K, V, I]) FetchByKey(key K) (V, error) {
+	return fetchByKey(s.values, key)
+}
+
+// FetchByIndex gets the all values in the snapshot by input index.
+// Try to fetch a non-existed index will cause an error return.
+func (s *Snapshot[K, V, I]) FetchByIndex(index I) ([]V, error) {
+	return fetchByIndex(s.values, s.indices, index)
+}
+
+// Transform applies the input callback function to each key-value pair in the snapshot and returns a new golang map.
+// Any error returned by the callback function will interrupt the transforming and the error will be returned.
+func (s *Snapshot[K, V, I]) Transform(callback func(K, V) (V, error)) (map[K]V, error) {
+	return transform(s.values, callback)
+}
+
+// Foreach applies the input callback function to each key-value pair in the snapshot.
+func (s *Snapshot[K, V, I]) Foreach(callback func(K, V)) {
+	foreach(s.values, callback)
+}
+
+// snapshot returns a snapshot of the store with the read locker held.
+// The snapshot shares the storage of the store, which is copied by own before the next change,
+// and it is cached until the store is changed, so taking snapshots of an unchanged store costs nothing.
+// With lazy expiration, the expired values are left out of a copy and the snapshot is not cached since it depends on the time.
+func (s *store[K, V, I]) snapshot(now time.Time) *Snapshot[K, V, I] {
+	s.smtx.Lock()
+	defer s.smtx.Unlock()
+
+	if s.cached != nil && s.cached.version == s.version && !s.lazy {
+		return s.cached
+	}
+
+	if !s.lazy {
+		s.cached = &Snapshot[K, V, I]{version: s.version, values: s.values, keys: s.keys, indices: s.indices}
+		s.shared = true
+		return s.cached
+	}
+
+	snapshot := &Snapshot[K, V, I]{
+		version: s.version,
+		values:  make(map[K]V, len(s.values)),
+		keys:    make(map[K][]I, len(s.keys)),
+		indices: make(map[I][]K, len(s.indices)),
+	}
+	for key, value := range s.values {
+		if s.lazy && s.isExpired(key, value, now) {
+			continue
+		}
+		snapshot.values[key] = value
+		snapshot.keys[key] = append([]I(nil), s.keys[key]...)
+	}
+	for index, keys := range s.indices {
+		for _, key := range keys {
+			if _, exist := snapshot.values[key]; exist {
+				snapshot.indices[index] = append(snapshot.indices[index], key)
+			}
+		}
+	}
+
+	return snapshot
+}
+
+// own copies the storage shared with the cached snapshot before the store is changed with the write locker held,
+// so the snapshot never sees the change.
+func (s *store[K, V, I]) own() {
+	if !s.shared {
+		return
+	}
+
+	values := make(map[K]V, len(s.values))
+	keys := make(map[K][]I, len(s.keys))
+	indices := make(map[I][]K, len(s.indices))
+	for key, value := range s.values {
+		values[key] = value
+		keys[key] = append([]I(nil), s.keys[key]...)
+	}
+	for index, list := range s.indices {
+		indices[index] = append([]K(nil), list...)
+	}
+
+	s.values, s.keys, s.indices = values, keys, indices
+	s.shared = false
+}
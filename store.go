@@ -0,0 +1,514 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"sync"
+	"time"
+)
+
+// Option configures the optional features of an emap.
+type Option func(*config)
+
+type config struct {
+	ttl         time.Duration   // default ttl of the inserted values
+	batch       int             // max number of values deleted in one batch of expiration
+	lazy        bool            // treat the expired values as absent in the read operations
+	purge       bool            // delete the expired values found by the read operations
+	sliding     bool            // refresh the deadline of a value when it is accessed
+	collected   bool            // values without ttl must implement ExpirableValue to be collected
+	extractors  []Extractor     // derive the indices from the values
+	maxEntries  int             // max number of keys, 0 means unlimited
+	evictPolicy EvictPolicy     // policy to choose the value to evict when the capacity is exceeded
+	maxSize     int             // max total size of the values, 0 means unlimited
+	sizer       Sizer           // estimates the size of a value, nil if the size is not tracked
+	unique      map[string]bool // names of the unique index families, empty name for the default indices
+	compare     Comparator      // orders the indices, nil if the indices are unordered
+}
+
+// WithTTL sets the default ttl of the values inserted into an expirable emap.
+// A value inserted with a ttl will be deleted automatically after the ttl even if it does not implement ExpirableValue.
+func WithTTL(ttl time.Duration) Option {
+	return func(c *config) {
+		c.ttl = ttl
+	}
+}
+
+// locker is implemented by sync.RWMutex and nopLocker.
+type locker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+}
+
+// nopLocker is used by the unlock emaps which have no locker inside.
+type nopLocker struct{}
+
+func (nopLocker) Lock()    {}
+func (nopLocker) Unlock()  {}
+func (nopLocker) RLock()   {}
+func (nopLocker) RUnlock() {}
+
+// store is embedded by all the emaps.
+// It holds the value, key and index storages together with the bookkeeping of the optional features,
+// so that every path adding or removing a value keeps the bookkeeping consistent in the same way.
+type store[K comparable, V any, I comparable] struct {
+	config
+	values     map[K]V                  // key -> value
+	keys       map[K][]I                // key -> indices
+	indices    map[I][]K                // index -> keys
+	families   map[string]*family[K, I] // name -> index family
+	deadlines  map[K]*deadline[K]       // key -> expiration deadline
+	schedules  deadlineHeap[K]          // expiration deadlines ordered by time
+	expirables keySet[K]                // keys whose values implement ExpirableValue
+	pmtx       sync.Mutex               // protects the policy which is also updated by the read operations
+	policy     policy[K]                // usage of the keys, nil if the capacity is unlimited
+	sizes      map[K]int                // key -> estimated size when it is inserted
+	size       int                      // total estimated size of the values
+	derived    map[K][]I                // key -> indices derived by the extractors
+	ordered    *skiplist[I]             // distinct indices ordered by the comparator, nil if the indices are unordered
+	serial     uint64                   // serial number given to the last inserted key
+	serials    map[K]uint64             // key -> serial number given when it is inserted
+	scanLog    []scanEntry[K]           // inserted keys in the order of the serial numbers, including the deleted ones
+	validIndex func(I) error            // checks the derived indices, nil unless the emap is a strict emap
+	onEvict    func(K, V, []I, EvictReason)
+	evicted    []eviction[K, V, I] // removed values waiting for the evict callback
+	evictions  map[EvictReason]int // number of the removed values of each reason
+	journal    *journal[K, V, I]   // states before the running transaction, nil if not in a transaction
+	version    uint64              // increased on each change of the values, keys or indices
+	smtx       sync.Mutex          // protects the cached snapshot which is taken with the read locker held
+	cached     *Snapshot[K, V, I]  // latest snapshot, valid while its version equals to the store's
+	shared     bool                // the value, key and index storages are shared with the cached snapshot
+}
+
+func (s *store[K, V, I]) init(options ...Option) {
+	for _, option := range options {
+		option(&s.config)
+	}
+	if s.batch <= 0 {
+		s.batch = defaultExpirationBatch
+	}
+
+	s.clear()
+	s.evictions = make(map[EvictReason]int)
+}
+
+func (s *store[K, V, I]) clear() {
+	s.values = make(map[K]V)
+	s.keys = make(map[K][]I)
+	s.indices = make(map[I][]K)
+	s.shared = false
+	s.families = make(map[string]*family[K, I])
+	s.deadlines = make(map[K]*deadline[K])
+	s.schedules = nil
+	s.expirables = newKeySet[K]()
+	s.sizes = make(map[K]int)
+	s.size = 0
+	s.derived = make(map[K][]I)
+	s.serials = make(map[K]uint64)
+	s.scanLog = nil
+	s.version++
+	if s.compare != nil {
+		s.ordered = newSkiplist[I](s.compare)
+	}
+	if s.maxEntries > 0 || s.maxSize > 0 {
+		s.policy = newPolicy[K](s.evictPolicy)
+	}
+}
+
+func (s *store[K, V, I]) insert(key K, value V, indices ...I) error {
+	if err := s.checkExpirable(key, value, s.ttl); err != nil {
+		return err
+	}
+
+	return s.insertWithTTL(key, value, s.ttl, indices...)
+}
+
+func (s *store[K, V, I]) insertWithTTL(key K, value V, ttl time.Duration, indices ...I) error {
+	size, err := s.measure(key, value)
+	if err != nil {
+		return err
+	}
+
+	var derived []I
+	if len(s.extractors) > 0 {
+		if derived, err = s.extract(value); err != nil {
+			return err
+		}
+		indices, derived = merge(indices, derived)
+	}
+	if _, exist := s.keys[key]; !exist {
+		if err := s.checkUnique("", key, indices...); err != nil {
+			return err
+		}
+	}
+
+	s.save(key)
+	for _, index := range indices {
+		s.saveIndex(index)
+	}
+	s.own()
+	if err := insert(s.values, s.keys, s.indices, key, value, indices...); err != nil {
+		return err
+	}
+	s.version++
+	s.order(indices...)
+	s.enlist(key)
+
+	if len(derived) > 0 {
+		s.derived[key] = derived
+	}
+	if s.sizer != nil {
+		s.sizes[key] = size
+		s.size += size
+	}
+	if ttl > 0 {
+		s.schedule(key, ttl)
+	}
+	if _, ok := any(value).(ExpirableValue); ok {
+		s.expirables.add(key)
+	}
+	s.admit(key)
+
+	return nil
+}
+
+// update replaces the value of an existing key in place, so the key never disappears from the emap.
+// The indices and the ttl of the key are kept.
+func (s *store[K, V, I]) update(key K, value V) error {
+	if _, exist := s.keys[key]; !exist {
+		return &KeyError{Key: key, Err: ErrKeyNotFound}
+	}
+
+	if err := s.checkExpirable(key, value, 0); err != nil {
+		return err
+	}
+
+	size, err := s.measure(key, value)
+	if err != nil {
+		return err
+	}
+
+	var derived []I
+	if len(s.extractors) > 0 {
+		if derived, err = s.extract(value); err != nil {
+			return err
+		}
+		if err := s.checkUnique("", key, derived...); err != nil {
+			return err
+		}
+	}
+
+	s.save(key)
+	s.own()
+	s.values[key] = value
+	s.version++
+	if len(s.extractors) > 0 {
+		s.reindex(key, derived)
+	}
+	if s.sizer != nil {
+		s.size += size - s.sizes[key]
+		s.sizes[key] = size
+	}
+	if _, ok := any(value).(ExpirableValue); ok {
+		s.expirables.add(key)
+	} else {
+		s.expirables.remove(key)
+	}
+	if s.policy != nil {
+		s.pmtx.Lock()
+		s.policy.remove(key)
+		s.pmtx.Unlock()
+		s.admit(key)
+	}
+
+	return nil
+}
+
+// upsert inserts the value if the key does not exist, otherwise it replaces the value and the indices of the key.
+// The indices of the key become exactly the input indices plus the ones derived from the new value.
+func (s *store[K, V, I]) upsert(key K, value V, indices ...I) error {
+	if _, exist := s.keys[key]; !exist {
+		return s.insert(key, value, indices...)
+	}
+
+	if err := s.checkUnique("", key, indices...); err != nil {
+		return err
+	}
+	if err := s.update(key, value); err != nil {
+		return err
+	}
+
+	for _, index := range append([]I(nil), s.keys[key]...) {
+		if !contains(indices, index) && !contains(s.derived[key], index) {
+			s.removeIndex(key, index)
+		}
+	}
+	for _, index := range indices {
+		// The only possible error is a duplicate index which is already on the key.
+		s.addIndex(key, index)
+	}
+
+	return nil
+}
+
+func (s *store[K, V, I]) deleteByKey(key K, reason EvictReason) error {
+	if _, exist := s.keys[key]; !exist {
+		return &KeyError{Key: key, Err: ErrKeyNotFound}
+	}
+
+	var indices []I
+	if s.ordered != nil {
+		indices = append(indices, s.keys[key]...)
+	}
+
+	s.save(key)
+	s.evict(key, reason)
+	s.own()
+	deleteByKey(s.values, s.keys, s.indices, key)
+	s.unindex(key)
+	delete(s.derived, key)
+	s.version++
+	s.order(indices...)
+	s.delist(key)
+	s.unschedule(key)
+	s.expirables.remove(key)
+	s.size -= s.sizes[key]
+	delete(s.sizes, key)
+	if s.policy != nil {
+		s.pmtx.Lock()
+		s.policy.remove(key)
+		s.pmtx.Unlock()
+	}
+
+	return nil
+}
+
+func (s *store[K, V, I]) deleteByIndex(index I, reason EvictReason) error {
+	if _, exist := s.indices[index]; !exist {
+		return &IndexError{Index: index, Err: ErrIndexNotFound}
+	}
+
+	keys := make([]K, len(s.indices[index]))
+	copy(keys, s.indices[index])
+
+	for _, key := range keys {
+		s.deleteByKey(key, reason)
+	}
+
+	return nil
+}
+
+func (s *store[K, V, I]) addIndex(key K, index I) error {
+	if _, exist := s.keys[key]; exist {
+		if err := s.checkUnique("", key, index); err != nil {
+			return err
+		}
+	}
+
+	s.save(key)
+	s.saveIndex(index)
+	s.version++
+	s.own()
+
+	err := addIndex(s.keys, s.indices, key, index)
+	s.order(index)
+
+	return err
+}
+
+func (s *store[K, V, I]) removeIndex(key K, index I) error {
+	s.save(key)
+	s.saveIndex(index)
+	s.version++
+	s.own()
+
+	err := removeIndex(s.keys, s.indices, key, index)
+	s.order(index)
+
+	return err
+}
+
+// read runs the input operation with the read locker held.
+// The locker is released even if the operation panics, e.g. in a callback function of the user.
+// The operation appends the expired values it finds to stale,
+// which will be deleted with the write locker held after the read locker is released if purge is enabled.
+func (s *store[K, V, I]) read(l locker, operation func(now time.Time, stale *[]K)) {
+	var stale []K
+
+	func() {
+		l.RLock()
+		defer l.RUnlock()
+
+		operation(time.Now(), &stale)
+	}()
+
+	if len(stale) == 0 || !s.purge {
+		return
+	}
+
+	s.write(l, func() error {
+		now := time.Now()
+		for _, key := range stale {
+			if value, exist := s.values[key]; exist && s.isExpired(key, value, now) {
+				s.deleteByKey(key, EvictExpired)
+			}
+		}
+		return nil
+	})
+}
+
+// accessed records the access to the input key for the sliding expiration and the evict policy.
+func (s *store[K, V, I]) accessed(key K, now time.Time) {
+	if s.sliding {
+		s.touch(key, now)
+	}
+
+	s.used(key)
+}
+
+func (s *store[K, V, I]) hasKey(key K, now time.Time, stale *[]K) bool {
+	return s.alive(key, now, stale)
+}
+
+func (s *store[K, V, I]) keyNumOfIndex(index I, now time.Time, stale *[]K) int {
+	return s.keyNumIn(s.indices, index, now, stale)
+}
+
+// keyNumIn returns the key number of the input index in the input index storage.
+func (s *store[K, V, I]) keyNumIn(indices map[I][]K, index I, now time.Time, stale *[]K) int {
+	if !s.lazy {
+		return len(indices[index])
+	}
+
+	num := 0
+	for _, key := range indices[index] {
+		if s.alive(key, now, stale) {
+			num++
+		}
+	}
+
+	return num
+}
+
+func (s *store[K, V, I]) hasIndex(index I, now time.Time, stale *[]K) bool {
+	return s.keyNumOfIndex(index, now, stale) > 0
+}
+
+func (s *store[K, V, I]) fetchByKey(key K, now time.Time, stale *[]K) (V, error) {
+	if !s.alive(key, now, stale) {
+		var zero V
+		return zero, &KeyError{Key: key, Err: ErrKeyNotFound}
+	}
+
+	s.accessed(key, now)
+
+	return s.values[key], nil
+}
+
+func (s *store[K, V, I]) fetchByIndex(index I, now time.Time, stale *[]K) ([]V, error) {
+	return s.fetchIn(s.indices, index, now, stale)
+}
+
+// fetchIn gets the values of the input index in the input index storage.
+func (s *store[K, V, I]) fetchIn(indices map[I][]K, index I, now time.Time, stale *[]K) ([]V, error) {
+	if !s.lazy && !s.sliding && s.policy == nil {
+		return fetchByIndex(s.values, indices, index)
+	}
+
+	var values []V
+	for _, key := range indices[index] {
+		if s.alive(key, now, stale) {
+			s.accessed(key, now)
+			values = append(values, s.values[key])
+		}
+	}
+	if len(values) == 0 {
+		return nil, &IndexError{Index: index, Err: ErrIndexNotFound}
+	}
+
+	return values, nil
+}
+
+// fetchKeysByIndex gets the keys of the input index, which is not counted as an access to the values.
+func (s *store[K, V, I]) fetchKeysByIndex(index I, now time.Time, stale *[]K) ([]K, error) {
+	var keys []K
+	for _, key := range s.indices[index] {
+		if s.alive(key, now, stale) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, &IndexError{Index: index, Err: ErrIndexNotFound}
+	}
+
+	return keys, nil
+}
+
+func (s *store[K, V, I]) fetchEntriesByIndex(index I, now time.Time, stale *[]K) ([]KeyValue[K, V], error) {
+	var pairs []KeyValue[K, V]
+	for _, key := range s.indices[index] {
+		if s.alive(key, now, stale) {
+			pairs = append(pairs, s.pair(key, now))
+		}
+	}
+	if len(pairs) == 0 {
+		return nil, &IndexError{Index: index, Err: ErrIndexNotFound}
+	}
+
+	return pairs, nil
+}
+
+// fetchIndicesByKey gets a copy of the indices of the input key, which is not counted as an access to the value.
+func (s *store[K, V, I]) fetchIndicesByKey(key K, now time.Time, stale *[]K) ([]I, error) {
+	if !s.alive(key, now, stale) {
+		return nil, &KeyError{Key: key, Err: ErrKeyNotFound}
+	}
+
+	return append([]I(nil), s.keys[key]...), nil
+}
+
+func (s *store[K, V, I]) foreach(callback func(K, V), now time.Time, stale *[]K) {
+	if !s.lazy {
+		foreach(s.values, callback)
+		return
+	}
+
+	for key, value := range s.values {
+		if s.alive(key, now, stale) {
+			callback(key, value)
+		}
+	}
+}
+
+func (s *store[K, V, I]) foreachUntil(callback func(K, V) bool, now time.Time, stale *[]K) {
+	if !s.lazy {
+		foreachUntil(s.values, callback)
+		return
+	}
+
+	for key, value := range s.values {
+		if s.alive(key, now, stale) && !callback(key, value) {
+			return
+		}
+	}
+}
+
+func (s *store[K, V, I]) foreachErr(callback func(K, V) error, now time.Time, stale *[]K) (err error) {
+	s.foreachUntil(func(key K, value V) bool {
+		err = callback(key, value)
+		return err == nil
+	}, now, stale)
+
+	return
+}
+
+// foreachByIndex walks a copy of the posting list of the input index, so the callback function of an unlock emap may change it.
+func (s *store[K, V, I]) foreachByIndex(index I, callback func(K, V), now time.Time, stale *[]K) {
+	for _, key := range append([]K(nil), s.indices[index]...) {
+		if s.alive(key, now, stale) && contains(s.keys[key], index) {
+			callback(key, s.values[key])
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"reflect"
 	"sync"
+	"time"
 )
 
 // StrictEMap has a read-write locker inside so it is concurrent safe.
@@ -13,10 +14,8 @@ import (
 // Only the types of the sample inputs matter, the values of the sample inputs are irrelevant.
 // All methods of the strict emap must use the same type of the sample inputs otherwise an error will be returned.
 type StrictEMap struct {
-	mtx     sync.RWMutex
-	values  map[interface{}]interface{}   // key -> value
-	keys    map[interface{}][]interface{} // key -> indices
-	indices map[interface{}][]interface{} // index -> keys
+	mtx sync.RWMutex
+	store[interface{}, interface{}, interface{}]
 
 	keyType     reflect.Kind
 	indexType   reflect.Kind
@@ -27,7 +26,8 @@ type StrictEMap struct {
 // NewStrictEMap creates a new strict emap.
 // The types of value, key and index are determined by the inputs.
 // Try to appoint any unsupported key or index types, such as pointer, will cause an error return.
-func NewStrictEMap(keySample interface{}, valueSample interface{}, indexSample interface{}) (*StrictEMap, error) {
+// Options such as WithMaxEntries are optional.
+func NewStrictEMap(keySample interface{}, valueSample interface{}, indexSample interface{}, options ...Option) (*StrictEMap, error) {
 	keyType := reflect.TypeOf(keySample).Kind()
 	indexType := reflect.TypeOf(indexSample).Kind()
 	valueType := reflect.TypeOf(valueSample).Kind()
@@ -36,9 +36,8 @@ func NewStrictEMap(keySample interface{}, valueSample interface{}, indexSample i
 	}
 
 	instance := new(StrictEMap)
-	instance.values = make(map[interface{}]interface{})
-	instance.keys = make(map[interface{}][]interface{})
-	instance.indices = make(map[interface{}][]interface{})
+	instance.init(options...)
+	instance.validIndex = instance.checkIndex
 
 	instance.keyType = keyType
 	instance.indexType = indexType
@@ -94,15 +93,12 @@ func (m *StrictEMap) KeyNum() int {
 }
 
 // KeyNumOfIndex returns the total key number of the input index in the emap.
-func (m *StrictEMap) KeyNumOfIndex(index interface{}) int {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
-
-	if keys, exist := m.indices[index]; exist {
-		return len(keys)
-	}
+func (m *StrictEMap) KeyNumOfIndex(index interface{}) (num int) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		num = m.keyNumOfIndex(index, now, stale)
+	})
 
-	return 0
+	return
 }
 
 // IndexNum returns the total index number in the emap.
@@ -113,6 +109,23 @@ func (m *StrictEMap) IndexNum() int {
 	return len(m.indices)
 }
 
+// Size returns the total size of the values in the emap estimated by the sizer of WithMaxSize.
+// It is always 0 if no sizer is given.
+func (m *StrictEMap) Size() int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return m.size
+}
+
+// EvictNum returns the total number of the values removed from the emap for the input reason.
+func (m *StrictEMap) EvictNum(reason EvictReason) int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return m.evictions[reason]
+}
+
 // IndexNumOfKey returns the total index number of the input key in the emap.
 func (m *StrictEMap) IndexNumOfKey(key interface{}) int {
 	m.mtx.RLock()
@@ -130,109 +143,383 @@ func (m *StrictEMap) IndexNumOfKey(key interface{}) int {
 }
 
 // HasKey returns if the input key exists in the emap.
-func (m *StrictEMap) HasKey(key interface{}) bool {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
-
+func (m *StrictEMap) HasKey(key interface{}) (exist bool) {
 	if m.keyType != reflect.TypeOf(key).Kind() {
 		return false
 	}
 
-	if _, exist := m.keys[key]; exist {
-		return true
-	}
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		exist = m.hasKey(key, now, stale)
+	})
 
-	return false
+	return
 }
 
 // HasIndex returns if the input index exists in the emap.
-func (m *StrictEMap) HasIndex(index interface{}) bool {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
-
+func (m *StrictEMap) HasIndex(index interface{}) (exist bool) {
 	if m.indexType != reflect.TypeOf(index).Kind() {
 		return false
 	}
 
-	if _, exist := m.indices[index]; exist {
-		return true
-	}
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		exist = m.hasIndex(index, now, stale)
+	})
 
-	return false
+	return
 }
 
 // Insert pushes a new value into emap with input key and indices.
 // Input key must not be duplicated.
 // Input indices are optional.
 func (m *StrictEMap) Insert(key interface{}, value interface{}, indices ...interface{}) error {
-	m.mtx.Lock()
-	defer m.mtx.Unlock()
+	if err := m.checkTypes(key, value, indices...); err != nil {
+		return err
+	}
 
-	if m.keyType != reflect.TypeOf(key).Kind() {
-		return errors.New("key type wrong")
+	return m.write(&m.mtx, func() error {
+		return m.insert(key, value, indices...)
+	})
+}
+
+// Upsert pushes the value into emap with input key and indices.
+// If the key exists, its value is replaced in place and its indices are replaced by the input indices,
+// while the indices derived by the index extractors follow the new value.
+// Input indices are optional.
+func (m *StrictEMap) Upsert(key interface{}, value interface{}, indices ...interface{}) error {
+	if err := m.checkTypes(key, value, indices...); err != nil {
+		return err
+	}
+
+	return m.write(&m.mtx, func() error {
+		return m.upsert(key, value, indices...)
+	})
+}
+
+// Update replaces the value in the emap of the input key in place, the indices of the key are kept.
+// Try to update a non-existed key will cause an error return.
+func (m *StrictEMap) Update(key interface{}, value interface{}) error {
+	if err := m.checkTypes(key, value); err != nil {
+		return err
+	}
+
+	return m.write(&m.mtx, func() error {
+		return m.update(key, value)
+	})
+}
+
+// checkTypes checks the types of the input key, value and indices against the types of the sample inputs.
+func (m *StrictEMap) checkTypes(key interface{}, value interface{}, indices ...interface{}) error {
+	if err := m.checkKey(key); err != nil {
+		return err
 	}
 	for _, index := range indices {
-		if m.indexType != reflect.TypeOf(index).Kind() {
-			return errors.New("index type wrong")
+		if err := m.checkIndex(index); err != nil {
+			return err
 		}
-
 	}
 	if m.valueType != reflect.TypeOf(value).Kind() {
-		return errors.New("value type wrong")
+		return &ValueError{Value: value, Err: ErrTypeMismatch}
 	}
 	if m.valueType == reflect.Struct && m.valueStruct != reflect.ValueOf(value).Type().Name() {
-		return errors.New("struct type wrong")
+		return &ValueError{Value: value, Err: ErrTypeMismatch}
+	}
+
+	return nil
+}
+
+func (m *StrictEMap) checkKey(key interface{}) error {
+	if m.keyType != reflect.TypeOf(key).Kind() {
+		return &KeyError{Key: key, Err: ErrTypeMismatch}
+	}
+
+	return nil
+}
+
+func (m *StrictEMap) checkIndex(index interface{}) error {
+	if m.indexType != reflect.TypeOf(index).Kind() {
+		return &IndexError{Index: index, Err: ErrTypeMismatch}
+	}
+
+	return nil
+}
+
+func (m *StrictEMap) checkIndices(indices ...interface{}) error {
+	for _, index := range indices {
+		if err := m.checkIndex(index); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Compute replaces the value in the emap of the input key by the result of the callback function atomically.
+// The callback function is called with the current value and whether it exists, and returns the new value and whether to keep it.
+// If keep is false the value is deleted, otherwise it is replaced in place or inserted without indices.
+// The callback function is called with the locker held, so it must not call back into the emap.
+func (m *StrictEMap) Compute(key interface{}, callback func(old interface{}, exist bool) (interface{}, bool)) error {
+	if m.keyType != reflect.TypeOf(key).Kind() {
+		return &KeyError{Key: key, Err: ErrTypeMismatch}
+	}
+
+	return m.write(&m.mtx, func() error {
+		return m.compute(key, func(old interface{}, exist bool) (interface{}, bool, error) {
+			value, keep := callback(old, exist)
+			if keep {
+				return value, keep, m.checkTypes(key, value)
+			}
+			return value, keep, nil
+		})
+	})
+}
+
+// CompareAndSwap replaces the value in the emap of the input key only if the current value equals to old, and returns if swapped.
+// Values of uncomparable types, such as slices and maps, never equal.
+// Try to swap a non-existed key will cause an error return.
+func (m *StrictEMap) CompareAndSwap(key interface{}, old interface{}, value interface{}) (swapped bool, err error) {
+	if err = m.checkTypes(key, value); err != nil {
+		return
+	}
+
+	m.write(&m.mtx, func() error {
+		swapped, err = m.compareAndSwap(key, old, value)
+		return err
+	})
+
+	return
+}
+
+// LoadOrStore returns the value in the emap of the input key if it exists and loaded is true.
+// Otherwise it pushes the input value into emap with input key and indices, and returns the input value.
+func (m *StrictEMap) LoadOrStore(key interface{}, value interface{}, indices ...interface{}) (actual interface{}, loaded bool, err error) {
+	if err = m.checkTypes(key, value, indices...); err != nil {
+		return
 	}
 
-	return insert(m.values, m.keys, m.indices, key, value, indices...)
+	m.write(&m.mtx, func() error {
+		actual, loaded, err = m.loadOrStore(key, value, indices...)
+		return err
+	})
+
+	return
+}
+
+// Txn runs the callback function as a transaction with the write locker of the emap held,
+// so other operations never see the intermediate states of the transaction.
+// If the callback function returns an error, all the changes made by the transaction are rolled back and the error is returned.
+// The callback function must not call back into the emap except through the input transaction.
+func (m *StrictEMap) Txn(callback func(tx Tx[interface{}, interface{}, interface{}]) error) error {
+	return m.write(&m.mtx, func() error {
+		return m.txn(&txn[interface{}, interface{}, interface{}]{store: &m.store, checker: m}, callback)
+	})
 }
 
 // FetchByKey gets the value in the emap by input key.
 // Try to fetch a non-existed key will cause an error return.
-func (m *StrictEMap) FetchByKey(key interface{}) (interface{}, error) {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
-
+func (m *StrictEMap) FetchByKey(key interface{}) (value interface{}, err error) {
 	if m.keyType != reflect.TypeOf(key).Kind() {
-		return nil, errors.New("key type wrong")
+		return nil, &KeyError{Key: key, Err: ErrTypeMismatch}
 	}
 
-	return fetchByKey(m.values, key)
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		value, err = m.fetchByKey(key, now, stale)
+	})
+
+	return
 }
 
 // FetchByIndex gets the all values in the emap by input index.
 // Try to fetch a non-existed index will cause an error return.
-func (m *StrictEMap) FetchByIndex(index interface{}) ([]interface{}, error) {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
+func (m *StrictEMap) FetchByIndex(index interface{}) (values []interface{}, err error) {
+	if m.indexType != reflect.TypeOf(index).Kind() {
+		return nil, &IndexError{Index: index, Err: ErrTypeMismatch}
+	}
+
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		values, err = m.fetchByIndex(index, now, stale)
+	})
 
+	return
+}
+
+// FetchOneByIndex gets the first value in the emap by input index, which is the only one if the index is unique.
+// Try to fetch a non-existed index will cause an error return.
+func (m *StrictEMap) FetchOneByIndex(index interface{}) (value interface{}, err error) {
 	if m.indexType != reflect.TypeOf(index).Kind() {
-		return nil, errors.New("index type wrong")
+		return nil, &IndexError{Index: index, Err: ErrTypeMismatch}
+	}
+
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		value, err = m.fetchOneIn(m.indices, index, now, stale)
+	})
+
+	return
+}
+
+// FetchByIndexRange gets the values in the emap whose indices are between lo and hi inclusively, in the ascending order of the indices.
+// A value having more than one index in the range is returned only once, and an empty range returns no value without error.
+// Try to fetch from an emap created without WithOrderedIndex will cause an error return.
+func (m *StrictEMap) FetchByIndexRange(lo, hi interface{}) (values []interface{}, err error) {
+	if m.indexType != reflect.TypeOf(lo).Kind() {
+		return nil, &IndexError{Index: lo, Err: ErrTypeMismatch}
+	}
+	if m.indexType != reflect.TypeOf(hi).Kind() {
+		return nil, &IndexError{Index: hi, Err: ErrTypeMismatch}
+	}
+
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		values, err = m.fetchByIndexRange(lo, hi, now, stale)
+	})
+
+	return
+}
+
+// Min gets the smallest index in the emap and all the values of it.
+// Try to get from an emap without any index or created without WithOrderedIndex will cause an error return.
+func (m *StrictEMap) Min() (index interface{}, values []interface{}, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		index, values, err = m.edge(false, now, stale)
+	})
+
+	return
+}
+
+// Max gets the largest index in the emap and all the values of it.
+// Try to get from an emap without any index or created without WithOrderedIndex will cause an error return.
+func (m *StrictEMap) Max() (index interface{}, values []interface{}, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		index, values, err = m.edge(true, now, stale)
+	})
+
+	return
+}
+
+// Ascend applies the input callback function to each index-value pair in the ascending order of the indices until it returns false.
+// A value having more than one index is visited once for each of its indices.
+// The callback function must not call back into the emap.
+// Try to iterate an emap created without WithOrderedIndex will cause an error return.
+func (m *StrictEMap) Ascend(callback func(interface{}, interface{}) bool) (err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		err = m.walk(false, callback, now, stale)
+	})
+
+	return
+}
+
+// Descend applies the input callback function to each index-value pair in the descending order of the indices until it returns false.
+// A value having more than one index is visited once for each of its indices.
+// The callback function must not call back into the emap.
+// Try to iterate an emap created without WithOrderedIndex will cause an error return.
+func (m *StrictEMap) Descend(callback func(interface{}, interface{}) bool) (err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		err = m.walk(true, callback, now, stale)
+	})
+
+	return
+}
+
+// FetchByAllIndices gets the key-value pairs in the emap having all the input indices.
+// Try to fetch without any match will return no pair without error.
+func (m *StrictEMap) FetchByAllIndices(indices ...interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	if err := m.checkIndices(indices...); err != nil {
+		return nil, err
+	}
+
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		pairs = m.fetchByAllIndices(indices, now, stale)
+	})
+
+	return
+}
+
+// FetchByAnyIndex gets the key-value pairs in the emap having any of the input indices, each key is returned only once.
+// Try to fetch without any match will return no pair without error.
+func (m *StrictEMap) FetchByAnyIndex(indices ...interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	if err := m.checkIndices(indices...); err != nil {
+		return nil, err
+	}
+
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		pairs = m.fetchByAnyIndex(indices, now, stale)
+	})
+
+	return
+}
+
+// FetchExcept gets the key-value pairs in the emap having the input index but none of the excluded indices.
+// Try to fetch without any match will return no pair without error.
+func (m *StrictEMap) FetchExcept(index interface{}, excluded ...interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	if err := m.checkIndices(append([]interface{}{index}, excluded...)...); err != nil {
+		return nil, err
+	}
+
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		pairs = m.fetchExcept(index, excluded, now, stale)
+	})
+
+	return
+}
+
+// FetchKeysByIndex gets the all keys in the emap by input index.
+// Try to fetch a non-existed index will cause an error return.
+func (m *StrictEMap) FetchKeysByIndex(index interface{}) (keys []interface{}, err error) {
+	if err := m.checkIndex(index); err != nil {
+		return nil, err
+	}
+
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		keys, err = m.fetchKeysByIndex(index, now, stale)
+	})
+
+	return
+}
+
+// FetchEntriesByIndex gets the all key-value pairs in the emap by input index.
+// Try to fetch a non-existed index will cause an error return.
+func (m *StrictEMap) FetchEntriesByIndex(index interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	if err := m.checkIndex(index); err != nil {
+		return nil, err
+	}
+
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		pairs, err = m.fetchEntriesByIndex(index, now, stale)
+	})
+
+	return
+}
+
+// FetchIndicesByKey gets the all indices in the emap by input key.
+// Try to fetch a non-existed key will cause an error return.
+func (m *StrictEMap) FetchIndicesByKey(key interface{}) (indices []interface{}, err error) {
+	if err := m.checkKey(key); err != nil {
+		return nil, err
 	}
 
-	return fetchByIndex(m.values, m.indices, index)
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		indices, err = m.fetchIndicesByKey(key, now, stale)
+	})
+
+	return
 }
 
 // DeleteByKey deletes the value in the emap by input key.
 // Try to delete a non-existed key will cause an error return.
 func (m *StrictEMap) DeleteByKey(key interface{}) error {
-	m.mtx.Lock()
-	defer m.mtx.Unlock()
-
-	return deleteByKey(m.values, m.keys, m.indices, key)
+	return m.write(&m.mtx, func() error {
+		return m.deleteByKey(key, EvictDeleted)
+	})
 }
 
 // DeleteByIndex deletes all the values in the emap by input index.
 // Try to delete a non-existed index will cause an error return.
 func (m *StrictEMap) DeleteByIndex(index interface{}) error {
-	m.mtx.Lock()
-	defer m.mtx.Unlock()
-
-	if m.indexType != reflect.TypeOf(index).Kind() {
-		return errors.New("index type wrong")
-	}
+	return m.write(&m.mtx, func() error {
+		if m.indexType != reflect.TypeOf(index).Kind() {
+			return &IndexError{Index: index, Err: ErrTypeMismatch}
+		}
 
-	return deleteByIndex(m.values, m.keys, m.indices, index)
+		return m.deleteByIndex(index, EvictDeleted)
+	})
 }
 
 // AddIndex add the input index to the value in the emap of the input key.
@@ -243,14 +530,14 @@ func (m *StrictEMap) AddIndex(key interface{}, index interface{}) error {
 	defer m.mtx.Unlock()
 
 	if m.keyType != reflect.TypeOf(key).Kind() {
-		return errors.New("key type wrong")
+		return &KeyError{Key: key, Err: ErrTypeMismatch}
 	}
 
 	if m.indexType != reflect.TypeOf(index).Kind() {
-		return errors.New("index type wrong")
+		return &IndexError{Index: index, Err: ErrTypeMismatch}
 	}
 
-	return addIndex(m.keys, m.indices, key, index)
+	return m.addIndex(key, index)
 }
 
 // RemoveIndex remove the input index from the value in the emap of the input key.
@@ -261,14 +548,61 @@ func (m *StrictEMap) RemoveIndex(key interface{}, index interface{}) error {
 	defer m.mtx.Unlock()
 
 	if m.keyType != reflect.TypeOf(key).Kind() {
-		return errors.New("key type wrong")
+		return &KeyError{Key: key, Err: ErrTypeMismatch}
 	}
 
 	if m.indexType != reflect.TypeOf(index).Kind() {
-		return errors.New("index type wrong")
+		return &IndexError{Index: index, Err: ErrTypeMismatch}
+	}
+
+	return m.removeIndex(key, index)
+}
+
+// Index returns the named index family of the emap, which has its own index storage scoped to the family.
+// The index family is created on the first index added to it, and the empty name means the default indices of the emap.
+func (m *StrictEMap) Index(name string) *IndexFamily[interface{}, interface{}, interface{}] {
+	return &IndexFamily[interface{}, interface{}, interface{}]{name: name, store: &m.store, locker: &m.mtx, checker: m}
+}
+
+// Query returns a new query on the emap, e.g. m.Query().Where(Index("region", "eu")).Filter(predicate).Limit(50).Fetch().
+func (m *StrictEMap) Query() *Query {
+	return &Query{store: &m.store, locker: &m.mtx, checker: m}
+}
+
+// OnEvict registers the callback function which is called for each value removed from the emap,
+// with the key, value and indices of the removed value and the reason of the removal.
+// The callback function is called after the locker of the emap is released, so it may safely call back into the emap.
+// Only one callback function is kept, a later call replaces the former one.
+func (m *StrictEMap) OnEvict(callback func(key interface{}, value interface{}, indices []interface{}, reason EvictReason)) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.onEvict = callback
+}
+
+// Scan gets at most count key-value pairs in the order of insertion after the input cursor, 10 pairs if count is not positive.
+// Start a scan with cursor 0 and pass the returned cursor to the next call, until the returned cursor is 0 again.
+// The emap may be changed between the calls, and each value which exists during the whole scan is returned exactly once.
+func (m *StrictEMap) Scan(cursor uint64, count int) (pairs []KeyValue[interface{}, interface{}], next uint64, err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		pairs, next = m.scan(cursor, count, now, stale)
+	})
+
+	return
+}
+
+// ScanIndex gets at most count key-value pairs of the input index like Scan.
+// Each value which has the input index during the whole scan is returned exactly once.
+func (m *StrictEMap) ScanIndex(index interface{}, cursor uint64, count int) (pairs []KeyValue[interface{}, interface{}], next uint64, err error) {
+	if err := m.checkIndex(index); err != nil {
+		return nil, 0, err
 	}
 
-	return removeIndex(m.keys, m.indices, key, index)
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		pairs, next = m.scanIndex(index, cursor, count, now, stale)
+	})
+
+	return
 }
 
 // Transform is a higher-order operation which apply the input callback function to each key-value pair in the emap.
@@ -285,8 +619,45 @@ func (m *StrictEMap) Transform(callback func(interface{}, interface{}) (interfac
 // Since the callback function has no return, the foreach procedure will never be interrupted.
 // A typical usage of Foreach is apply a closure.
 func (m *StrictEMap) Foreach(callback func(interface{}, interface{})) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		m.foreach(callback, now, stale)
+	})
+}
+
+// ForeachUntil applies the input callback function to each key-value pair in the emap until the callback function returns false.
+func (m *StrictEMap) ForeachUntil(callback func(interface{}, interface{}) bool) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		m.foreachUntil(callback, now, stale)
+	})
+}
+
+// ForeachErr applies the input callback function to each key-value pair in the emap.
+// Any error returned by the callback function will interrupt the procedure and the error will be returned.
+func (m *StrictEMap) ForeachErr(callback func(interface{}, interface{}) error) (err error) {
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		err = m.foreachErr(callback, now, stale)
+	})
+
+	return
+}
+
+// ForeachByIndex applies the input callback function to each key-value pair of the input index in the emap.
+// Only the keys of the input index are walked, and nothing is done for a non-existed index.
+func (m *StrictEMap) ForeachByIndex(index interface{}, callback func(interface{}, interface{})) {
+	if m.indexType != reflect.TypeOf(index).Kind() {
+		return
+	}
+
+	m.read(&m.mtx, func(now time.Time, stale *[]interface{}) {
+		m.foreachByIndex(index, callback, now, stale)
+	})
+}
+
+// Snapshot returns a consistent read-only view of the emap which can be read without holding the locker of the emap.
+// Taking a snapshot copies nothing without lazy expiration, but the next change of the emap copies its storage once, which costs O(n).
+func (m *StrictEMap) Snapshot() *Snapshot[interface{}, interface{}, interface{}] {
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
 
-	foreach(m.values, callback)
+	return m.snapshot(time.Now())
 }
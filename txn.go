@@ -0,0 +1,309 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Tx is the transaction passed to the callback function of Txn.
+// All the operations of a transaction are performed with the write locker of the emap held,
+// so the intermediate states are never seen by other operations.
+// A transaction must not be used after the callback function returns.
+type Tx[K comparable, V any, I comparable] interface {
+	// Insert pushes a new value into emap with input key and indices.
+	Insert(key K, value V, indices ...I) error
+	// DeleteByKey deletes the value in the emap by input key.
+	DeleteByKey(key K) error
+	// AddIndex add the input index to the value in the emap of the input key.
+	AddIndex(key K, index I) error
+	// RemoveIndex remove the input index from the value in the emap of the input key.
+	RemoveIndex(key K, index I) error
+	// FetchByKey gets the value in the emap by input key.
+	FetchByKey(key K) (V, error)
+	// FetchByIndex gets the all values in the emap by input index.
+	FetchByIndex(index I) ([]V, error)
+}
+
+// checker checks the types of the inputs, implemented by the strict emap.
+type checker[K comparable, V any, I comparable] interface {
+	checkKey(key K) error
+	checkIndex(index I) error
+	checkTypes(key K, value V, indices ...I) error
+}
+
+// txn implements Tx on the store of an emap.
+// The checker is nil unless the emap is a strict emap.
+type txn[K comparable, V any, I comparable] struct {
+	store   *store[K, V, I]
+	checker checker[K, V, I]
+}
+
+func (tx *txn[K, V, I]) Insert(key K, value V, indices ...I) error {
+	if tx.checker != nil {
+		if err := tx.checker.checkTypes(key, value, indices...); err != nil {
+			return err
+		}
+	}
+
+	return tx.store.insert(key, value, indices...)
+}
+
+func (tx *txn[K, V, I]) DeleteByKey(key K) error {
+	return tx.store.deleteByKey(key, EvictDeleted)
+}
+
+func (tx *txn[K, V, I]) AddIndex(key K, index I) error {
+	if err := tx.checkKeyIndex(key, index); err != nil {
+		return err
+	}
+
+	return tx.store.addIndex(key, index)
+}
+
+func (tx *txn[K, V, I]) RemoveIndex(key K, index I) error {
+	if err := tx.checkKeyIndex(key, index); err != nil {
+		return err
+	}
+
+	return tx.store.removeIndex(key, index)
+}
+
+func (tx *txn[K, V, I]) FetchByKey(key K) (V, error) {
+	if tx.checker != nil {
+		if err := tx.checker.checkKey(key); err != nil {
+			var zero V
+			return zero, err
+		}
+	}
+
+	var stale []K
+	return tx.store.fetchByKey(key, time.Now(), &stale)
+}
+
+func (tx *txn[K, V, I]) FetchByIndex(index I) ([]V, error) {
+	if tx.checker != nil {
+		if err := tx.checker.checkIndex(index); err != nil {
+			return nil, err
+		}
+	}
+
+	var stale []K
+	return tx.store.fetchByIndex(index, time.Now(), &stale)
+}
+
+func (tx *txn[K, V, I]) checkKeyIndex(key K, index I) error {
+	if tx.checker == nil {
+		return nil
+	}
+
+	if err := tx.checker.checkKey(key); err != nil {
+		return err
+	}
+
+	return tx.checker.checkIndex(index)
+}
+
+// journal records the states of the keys and indices before they are first changed in a transaction,
+// so that the store can be rolled back to the state before the transaction.
+type journal[K comparable, V any, I comparable] struct {
+	keys      map[K]keyState[K, V, I]
+	indices   map[I]indexState[K]
+	families  map[familyIndex[I]]indexState[K]
+	evicted   int                 // number of the evictions waiting for the callback before the transaction
+	evictions map[EvictReason]int // eviction counters before the transaction
+}
+
+type keyState[K comparable, V any, I comparable] struct {
+	exist     bool
+	value     V
+	indices   []I
+	deadline  *deadline[K]
+	expirable bool
+	size      int
+	families  map[string][]I // family name -> indices in the family
+	derived   []I
+	serial    uint64
+}
+
+type familyIndex[I comparable] struct {
+	name  string
+	index I
+}
+
+type indexState[K comparable] struct {
+	exist bool
+	keys  []K
+}
+
+// txn runs the callback function as a transaction with the write locker held.
+// If the callback function returns an error or panics, all the changes made by the transaction are rolled back
+// and the values removed by the transaction will not be passed to the evict callback.
+func (s *store[K, V, I]) txn(tx *txn[K, V, I], callback func(tx Tx[K, V, I]) error) error {
+	s.journal = &journal[K, V, I]{
+		keys:      make(map[K]keyState[K, V, I]),
+		indices:   make(map[I]indexState[K]),
+		families:  make(map[familyIndex[I]]indexState[K]),
+		evicted:   len(s.evicted),
+		evictions: make(map[EvictReason]int, len(s.evictions)),
+	}
+	for reason, num := range s.evictions {
+		s.journal.evictions[reason] = num
+	}
+	defer func() {
+		s.journal = nil
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			s.rollback()
+			panic(r)
+		}
+	}()
+
+	if err := callback(tx); err != nil {
+		s.rollback()
+		return err
+	}
+
+	return nil
+}
+
+// save records the state of the input key and its indices if it is in a transaction.
+func (s *store[K, V, I]) save(key K) {
+	if s.journal == nil {
+		return
+	}
+
+	if _, saved := s.journal.keys[key]; saved {
+		return
+	}
+
+	value, exist := s.values[key]
+	indices := make([]I, len(s.keys[key]))
+	copy(indices, s.keys[key])
+	expirable := s.expirables.has(key)
+	families := make(map[string][]I)
+	for name, f := range s.families {
+		if indices, exist := f.keys[key]; exist {
+			families[name] = append([]I(nil), indices...)
+		}
+	}
+	derived := append([]I(nil), s.derived[key]...)
+	s.journal.keys[key] = keyState[K, V, I]{exist, value, indices, s.deadlines[key], expirable, s.sizes[key], families, derived, s.serials[key]}
+
+	for _, index := range indices {
+		s.saveIndex(index)
+	}
+	for name, indices := range families {
+		for _, index := range indices {
+			s.saveFamilyIndex(name, index)
+		}
+	}
+}
+
+// saveFamilyIndex records the keys of the input index of the named family if it is in a transaction.
+func (s *store[K, V, I]) saveFamilyIndex(name string, index I) {
+	if s.journal == nil {
+		return
+	}
+
+	if _, saved := s.journal.families[familyIndex[I]{name, index}]; saved {
+		return
+	}
+
+	keys, exist := s.familyIndices(name)[index]
+	s.journal.families[familyIndex[I]{name, index}] = indexState[K]{exist, append([]K(nil), keys...)}
+}
+
+// saveIndex records the keys of the input index if it is in a transaction.
+func (s *store[K, V, I]) saveIndex(index I) {
+	if s.journal == nil {
+		return
+	}
+
+	if _, saved := s.journal.indices[index]; saved {
+		return
+	}
+
+	keys, exist := s.indices[index]
+	s.journal.indices[index] = indexState[K]{exist, append([]K(nil), keys...)}
+}
+
+// rollback restores the states recorded in the journal.
+func (s *store[K, V, I]) rollback() {
+	s.own()
+	for key, state := range s.journal.keys {
+		if d, exist := s.deadlines[key]; exist && d != state.deadline {
+			s.unschedule(key)
+		}
+		s.size -= s.sizes[key]
+		delete(s.sizes, key)
+		s.expirables.remove(key)
+		if s.policy != nil {
+			s.pmtx.Lock()
+			s.policy.remove(key)
+			s.pmtx.Unlock()
+		}
+
+		for _, f := range s.families {
+			delete(f.keys, key)
+		}
+		delete(s.derived, key)
+
+		if !state.exist {
+			delete(s.values, key)
+			delete(s.keys, key)
+			delete(s.serials, key)
+			continue
+		}
+
+		s.values[key] = state.value
+		s.serials[key] = state.serial
+		s.keys[key] = state.indices
+		for name, indices := range state.families {
+			s.families[name].keys[key] = indices
+		}
+		if len(state.derived) > 0 {
+			s.derived[key] = state.derived
+		}
+		if state.deadline != nil && s.deadlines[key] != state.deadline {
+			heap.Push(&s.schedules, state.deadline)
+			s.deadlines[key] = state.deadline
+		}
+		if state.expirable {
+			s.expirables.add(key)
+		}
+		if s.sizer != nil {
+			s.sizes[key] = state.size
+			s.size += state.size
+		}
+		if s.policy != nil {
+			s.pmtx.Lock()
+			s.policy.add(key)
+			s.pmtx.Unlock()
+		}
+	}
+
+	for index, state := range s.journal.indices {
+		if state.exist {
+			s.indices[index] = state.keys
+		} else {
+			delete(s.indices, index)
+		}
+		s.order(index)
+	}
+
+	for fi, state := range s.journal.families {
+		f := s.families[fi.name]
+		if state.exist {
+			f.indices[fi.index] = state.keys
+		} else {
+			delete(f.indices, fi.index)
+		}
+	}
+
+	s.evicted = s.evicted[:s.journal.evicted]
+	s.evictions = s.journal.evictions
+	s.version++
+}
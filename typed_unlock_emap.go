@@ -0,0 +1,406 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import "time"
+
+// TypedUnlockEMap basically is a typed emap without internal locker or mutex.
+// So typed unlock emap is not concurrent safe, it is only suitable for those models like Event Loop to achieve better performance.
+type TypedUnlockEMap[K comparable, V any, I comparable] struct {
+	store[K, V, I]
+}
+
+// NewTypedUnlockEMap creates a new typed unlock emap.
+// Options such as WithMaxEntries are optional.
+func NewTypedUnlockEMap[K comparable, V any, I comparable](options ...Option) *TypedUnlockEMap[K, V, I] {
+	instance := new(TypedUnlockEMap[K, V, I])
+	instance.init(options...)
+
+	return instance
+}
+
+// KeyNum returns the total key number in the emap.
+func (m *TypedUnlockEMap[K, V, I]) KeyNum() int {
+	return len(m.keys)
+}
+
+// KeyNumOfIndex returns the total key number of the input index in the emap.
+func (m *TypedUnlockEMap[K, V, I]) KeyNumOfIndex(index I) (num int) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		num = m.keyNumOfIndex(index, now, stale)
+	})
+
+	return
+}
+
+// IndexNum returns the total index number in the emap.
+func (m *TypedUnlockEMap[K, V, I]) IndexNum() int {
+	return len(m.indices)
+}
+
+// Size returns the total size of the values in the emap estimated by the sizer of WithMaxSize.
+// It is always 0 if no sizer is given.
+func (m *TypedUnlockEMap[K, V, I]) Size() int {
+	return m.size
+}
+
+// EvictNum returns the total number of the values removed from the emap for the input reason.
+func (m *TypedUnlockEMap[K, V, I]) EvictNum(reason EvictReason) int {
+	return m.evictions[reason]
+}
+
+// IndexNumOfKey returns the total index number of the input key in the emap.
+func (m *TypedUnlockEMap[K, V, I]) IndexNumOfKey(key K) int {
+	if indices, exist := m.keys[key]; exist {
+		return len(indices)
+	}
+
+	return 0
+}
+
+// HasKey returns if the input key exists in the emap.
+func (m *TypedUnlockEMap[K, V, I]) HasKey(key K) (exist bool) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		exist = m.hasKey(key, now, stale)
+	})
+
+	return
+}
+
+// HasIndex returns if the input index exists in the emap.
+func (m *TypedUnlockEMap[K, V, I]) HasIndex(index I) (exist bool) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		exist = m.hasIndex(index, now, stale)
+	})
+
+	return
+}
+
+// Insert pushes a new value into emap with input key and indices.
+// Input key must not be duplicated.
+// Input indices are optional.
+func (m *TypedUnlockEMap[K, V, I]) Insert(key K, value V, indices ...I) error {
+	return m.write(nopLocker{}, func() error {
+		return m.insert(key, value, indices...)
+	})
+}
+
+// Upsert pushes the value into emap with input key and indices.
+// If the key exists, its value is replaced in place and its indices are replaced by the input indices,
+// while the indices derived by the index extractors follow the new value.
+// Input indices are optional.
+func (m *TypedUnlockEMap[K, V, I]) Upsert(key K, value V, indices ...I) error {
+	return m.write(nopLocker{}, func() error {
+		return m.upsert(key, value, indices...)
+	})
+}
+
+// Update replaces the value in the emap of the input key in place, the indices of the key are kept.
+// Try to update a non-existed key will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) Update(key K, value V) error {
+	return m.write(nopLocker{}, func() error {
+		return m.update(key, value)
+	})
+}
+
+// Compute replaces the value in the emap of the input key by the result of the callback function atomically.
+// The callback function is called with the current value and whether it exists, and returns the new value and whether to keep it.
+// If keep is false the value is deleted, otherwise it is replaced in place or inserted without indices.
+// The callback function is called with the locker held, so it must not call back into the emap.
+func (m *TypedUnlockEMap[K, V, I]) Compute(key K, callback func(old V, exist bool) (V, bool)) error {
+	return m.write(nopLocker{}, func() error {
+		return m.compute(key, func(old V, exist bool) (V, bool, error) {
+			value, keep := callback(old, exist)
+			return value, keep, nil
+		})
+	})
+}
+
+// CompareAndSwap replaces the value in the emap of the input key only if the current value equals to old, and returns if swapped.
+// Values of uncomparable types, such as slices and maps, never equal.
+// Try to swap a non-existed key will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) CompareAndSwap(key K, old V, value V) (swapped bool, err error) {
+	m.write(nopLocker{}, func() error {
+		swapped, err = m.compareAndSwap(key, old, value)
+		return err
+	})
+
+	return
+}
+
+// LoadOrStore returns the value in the emap of the input key if it exists and loaded is true.
+// Otherwise it pushes the input value into emap with input key and indices, and returns the input value.
+func (m *TypedUnlockEMap[K, V, I]) LoadOrStore(key K, value V, indices ...I) (actual V, loaded bool, err error) {
+	m.write(nopLocker{}, func() error {
+		actual, loaded, err = m.loadOrStore(key, value, indices...)
+		return err
+	})
+
+	return
+}
+
+// Txn runs the callback function as a transaction.
+// If the callback function returns an error, all the changes made by the transaction are rolled back and the error is returned.
+// The callback function should only change the emap through the input transaction.
+func (m *TypedUnlockEMap[K, V, I]) Txn(callback func(tx Tx[K, V, I]) error) error {
+	return m.write(nopLocker{}, func() error {
+		return m.txn(&txn[K, V, I]{store: &m.store}, callback)
+	})
+}
+
+// FetchByKey gets the value in the emap by input key.
+// Try to fetch a non-existed key will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) FetchByKey(key K) (value V, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		value, err = m.fetchByKey(key, now, stale)
+	})
+
+	return
+}
+
+// FetchByIndex gets the all values in the emap by input index.
+// Try to fetch a non-existed index will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) FetchByIndex(index I) (values []V, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		values, err = m.fetchByIndex(index, now, stale)
+	})
+
+	return
+}
+
+// FetchOneByIndex gets the first value in the emap by input index, which is the only one if the index is unique.
+// Try to fetch a non-existed index will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) FetchOneByIndex(index I) (value V, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		value, err = m.fetchOneIn(m.indices, index, now, stale)
+	})
+
+	return
+}
+
+// FetchByIndexRange gets the values in the emap whose indices are between lo and hi inclusively, in the ascending order of the indices.
+// A value having more than one index in the range is returned only once, and an empty range returns no value without error.
+// Try to fetch from an emap created without WithOrderedIndex will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) FetchByIndexRange(lo, hi I) (values []V, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		values, err = m.fetchByIndexRange(lo, hi, now, stale)
+	})
+
+	return
+}
+
+// Min gets the smallest index in the emap and all the values of it.
+// Try to get from an emap without any index or created without WithOrderedIndex will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) Min() (index I, values []V, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		index, values, err = m.edge(false, now, stale)
+	})
+
+	return
+}
+
+// Max gets the largest index in the emap and all the values of it.
+// Try to get from an emap without any index or created without WithOrderedIndex will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) Max() (index I, values []V, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		index, values, err = m.edge(true, now, stale)
+	})
+
+	return
+}
+
+// Ascend applies the input callback function to each index-value pair in the ascending order of the indices until it returns false.
+// A value having more than one index is visited once for each of its indices.
+// The callback function must not call back into the emap.
+// Try to iterate an emap created without WithOrderedIndex will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) Ascend(callback func(I, V) bool) (err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		err = m.walk(false, callback, now, stale)
+	})
+
+	return
+}
+
+// Descend applies the input callback function to each index-value pair in the descending order of the indices until it returns false.
+// A value having more than one index is visited once for each of its indices.
+// The callback function must not call back into the emap.
+// Try to iterate an emap created without WithOrderedIndex will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) Descend(callback func(I, V) bool) (err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		err = m.walk(true, callback, now, stale)
+	})
+
+	return
+}
+
+// FetchByAllIndices gets the key-value pairs in the emap having all the input indices.
+// Try to fetch without any match will return no pair without error.
+func (m *TypedUnlockEMap[K, V, I]) FetchByAllIndices(indices ...I) (pairs []KeyValue[K, V], err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		pairs = m.fetchByAllIndices(indices, now, stale)
+	})
+
+	return
+}
+
+// FetchByAnyIndex gets the key-value pairs in the emap having any of the input indices, each key is returned only once.
+// Try to fetch without any match will return no pair without error.
+func (m *TypedUnlockEMap[K, V, I]) FetchByAnyIndex(indices ...I) (pairs []KeyValue[K, V], err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		pairs = m.fetchByAnyIndex(indices, now, stale)
+	})
+
+	return
+}
+
+// FetchExcept gets the key-value pairs in the emap having the input index but none of the excluded indices.
+// Try to fetch without any match will return no pair without error.
+func (m *TypedUnlockEMap[K, V, I]) FetchExcept(index I, excluded ...I) (pairs []KeyValue[K, V], err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		pairs = m.fetchExcept(index, excluded, now, stale)
+	})
+
+	return
+}
+
+// FetchKeysByIndex gets the all keys in the emap by input index.
+// Try to fetch a non-existed index will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) FetchKeysByIndex(index I) (keys []K, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		keys, err = m.fetchKeysByIndex(index, now, stale)
+	})
+
+	return
+}
+
+// FetchEntriesByIndex gets the all key-value pairs in the emap by input index.
+// Try to fetch a non-existed index will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) FetchEntriesByIndex(index I) (pairs []KeyValue[K, V], err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		pairs, err = m.fetchEntriesByIndex(index, now, stale)
+	})
+
+	return
+}
+
+// FetchIndicesByKey gets the all indices in the emap by input key.
+// Try to fetch a non-existed key will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) FetchIndicesByKey(key K) (indices []I, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		indices, err = m.fetchIndicesByKey(key, now, stale)
+	})
+
+	return
+}
+
+// DeleteByKey deletes the value in the emap by input key.
+// Try to delete a non-existed key will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) DeleteByKey(key K) error {
+	return m.write(nopLocker{}, func() error {
+		return m.deleteByKey(key, EvictDeleted)
+	})
+}
+
+// DeleteByIndex deletes all the values in the emap by input index.
+// Try to delete a non-existed index will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) DeleteByIndex(index I) error {
+	return m.write(nopLocker{}, func() error {
+		return m.deleteByIndex(index, EvictDeleted)
+	})
+}
+
+// AddIndex add the input index to the value in the emap of the input key.
+// Try to add a duplicate index will cause an error return.
+// Try to add an index to a non-existed value will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) AddIndex(key K, index I) error {
+	return m.addIndex(key, index)
+}
+
+// RemoveIndex remove the input index from the value in the emap of the input key.
+// Try to delete a non-existed index will cause an error return.
+// Try to delete an index from a non-existed value will cause an error return.
+func (m *TypedUnlockEMap[K, V, I]) RemoveIndex(key K, index I) error {
+	return m.removeIndex(key, index)
+}
+
+// Index returns the named index family of the emap, which has its own index storage scoped to the family.
+// The index family is created on the first index added to it, and the empty name means the default indices of the emap.
+func (m *TypedUnlockEMap[K, V, I]) Index(name string) *IndexFamily[K, V, I] {
+	return &IndexFamily[K, V, I]{name: name, store: &m.store, locker: nopLocker{}}
+}
+
+// OnEvict registers the callback function which is called for each value removed from the emap,
+// with the key, value and indices of the removed value and the reason of the removal.
+// The callback function is called after the removal is finished, so it may safely call back into the emap.
+// Only one callback function is kept, a later call replaces the former one.
+func (m *TypedUnlockEMap[K, V, I]) OnEvict(callback func(key K, value V, indices []I, reason EvictReason)) {
+	m.onEvict = callback
+}
+
+// Scan gets at most count key-value pairs in the order of insertion after the input cursor, 10 pairs if count is not positive.
+// Start a scan with cursor 0 and pass the returned cursor to the next call, until the returned cursor is 0 again.
+// The emap may be changed between the calls, and each value which exists during the whole scan is returned exactly once.
+func (m *TypedUnlockEMap[K, V, I]) Scan(cursor uint64, count int) (pairs []KeyValue[K, V], next uint64, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		pairs, next = m.scan(cursor, count, now, stale)
+	})
+
+	return
+}
+
+// ScanIndex gets at most count key-value pairs of the input index like Scan.
+// Each value which has the input index during the whole scan is returned exactly once.
+func (m *TypedUnlockEMap[K, V, I]) ScanIndex(index I, cursor uint64, count int) (pairs []KeyValue[K, V], next uint64, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		pairs, next = m.scanIndex(index, cursor, count, now, stale)
+	})
+
+	return
+}
+
+// Transform is a higher-order operation which apply the input callback function to each key-value pair in the emap.
+// Any error returned by the callback function will interrupt the transforming and the error will be returned.
+// If transform successfully, a new golang map is created with each key-value pair returned by the input callback function.
+func (m *TypedUnlockEMap[K, V, I]) Transform(callback func(K, V) (V, error)) (map[K]V, error) {
+	return transform(m.values, callback)
+}
+
+// Foreach is a higher-order operation which apply the input callback function to each key-value pair in the emap.
+// Since the callback function has no return, the foreach procedure will never be interrupted.
+// A typical usage of Foreach is apply a closure.
+func (m *TypedUnlockEMap[K, V, I]) Foreach(callback func(K, V)) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		m.foreach(callback, now, stale)
+	})
+}
+
+// ForeachUntil applies the input callback function to each key-value pair in the emap until the callback function returns false.
+func (m *TypedUnlockEMap[K, V, I]) ForeachUntil(callback func(K, V) bool) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		m.foreachUntil(callback, now, stale)
+	})
+}
+
+// ForeachErr applies the input callback function to each key-value pair in the emap.
+// Any error returned by the callback function will interrupt the procedure and the error will be returned.
+func (m *TypedUnlockEMap[K, V, I]) ForeachErr(callback func(K, V) error) (err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		err = m.foreachErr(callback, now, stale)
+	})
+
+	return
+}
+
+// ForeachByIndex applies the input callback function to each key-value pair of the input index in the emap.
+// Only the keys of the input index are walked, and nothing is done for a non-existed index.
+func (m *TypedUnlockEMap[K, V, I]) ForeachByIndex(index I, callback func(K, V)) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]K) {
+		m.foreachByIndex(index, callback, now, stale)
+	})
+}
+
+// Snapshot returns a consistent read-only view of the emap which is not affected by the later changes of the emap.
+// Taking a snapshot copies nothing without lazy expiration, but the next change of the emap copies its storage once, which costs O(n).
+func (m *TypedUnlockEMap[K, V, I]) Snapshot() *Snapshot[K, V, I] {
+	return m.snapshot(time.Now())
+}
@@ -0,0 +1,50 @@
+// Copyright(c) 2016 Ethan Zhuang <zhuangwj@gmail.com>.
+
+package emap
+
+import (
+	"time"
+)
+
+// WithUniqueIndex makes the named index family unique, so an index of the family maps to at most one key.
+// The empty name means the default indices of the emap.
+// Try to insert a value with or add an index which is already held by another key will cause a ConstraintError return.
+func WithUniqueIndex(family string) Option {
+	return func(c *config) {
+		if c.unique == nil {
+			c.unique = make(map[string]bool)
+		}
+		c.unique[family] = true
+	}
+}
+
+// checkUnique checks if the input indices of the named family can be added to the input key.
+func (s *store[K, V, I]) checkUnique(family string, key K, indices ...I) error {
+	if !s.unique[family] {
+		return nil
+	}
+
+	store := s.familyIndices(family)
+	for _, index := range indices {
+		for _, each := range store[index] {
+			if each != key {
+				return &ConstraintError{Family: family, Index: index, Key: each, Err: ErrUniqueViolation}
+			}
+		}
+	}
+
+	return nil
+}
+
+// fetchOneIn gets the first value of the input index in the input index storage.
+func (s *store[K, V, I]) fetchOneIn(indices map[I][]K, index I, now time.Time, stale *[]K) (V, error) {
+	for _, key := range indices[index] {
+		if s.alive(key, now, stale) {
+			s.accessed(key, now)
+			return s.values[key], nil
+		}
+	}
+
+	var zero V
+	return zero, &IndexError{Index: index, Err: ErrIndexNotFound}
+}
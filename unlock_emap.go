@@ -2,20 +2,19 @@
 
 package emap
 
+import "time"
+
 // UnlockEMap basically is a generic emap without internal locker or mutex.
 // So unlock emap is not concurrent safe, it is only suitable for those models like Event Loop to achieve better performance.
 type UnlockEMap struct {
-	values  map[interface{}]interface{}   // key -> value
-	keys    map[interface{}][]interface{} // key -> indices
-	indices map[interface{}][]interface{} // index -> keys
+	store[interface{}, interface{}, interface{}]
 }
 
 // NewUnlockEMap creates a new unlock emap.
-func NewUnlockEMap() *UnlockEMap {
+// Options such as WithMaxEntries are optional.
+func NewUnlockEMap(options ...Option) *UnlockEMap {
 	instance := new(UnlockEMap)
-	instance.values = make(map[interface{}]interface{})
-	instance.keys = make(map[interface{}][]interface{})
-	instance.indices = make(map[interface{}][]interface{})
+	instance.init(options...)
 
 	return instance
 }
@@ -26,12 +25,12 @@ func (m *UnlockEMap) KeyNum() int {
 }
 
 // KeyNumOfIndex returns the total key number of the input index in the emap.
-func (m *UnlockEMap) KeyNumOfIndex(index interface{}) int {
-	if keys, exist := m.indices[index]; exist {
-		return len(keys)
-	}
+func (m *UnlockEMap) KeyNumOfIndex(index interface{}) (num int) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		num = m.keyNumOfIndex(index, now, stale)
+	})
 
-	return 0
+	return
 }
 
 // IndexNum returns the total index number in the emap.
@@ -39,6 +38,17 @@ func (m *UnlockEMap) IndexNum() int {
 	return len(m.indices)
 }
 
+// Size returns the total size of the values in the emap estimated by the sizer of WithMaxSize.
+// It is always 0 if no sizer is given.
+func (m *UnlockEMap) Size() int {
+	return m.size
+}
+
+// EvictNum returns the total number of the values removed from the emap for the input reason.
+func (m *UnlockEMap) EvictNum(reason EvictReason) int {
+	return m.evictions[reason]
+}
+
 // IndexNumOfKey returns the total index number of the input key in the emap.
 func (m *UnlockEMap) IndexNumOfKey(key interface{}) int {
 	if indices, exist := m.keys[key]; exist {
@@ -49,66 +59,308 @@ func (m *UnlockEMap) IndexNumOfKey(key interface{}) int {
 }
 
 // HasKey returns if the input key exists in the emap.
-func (m *UnlockEMap) HasKey(key interface{}) bool {
-	if _, exist := m.keys[key]; exist {
-		return true
-	}
+func (m *UnlockEMap) HasKey(key interface{}) (exist bool) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		exist = m.hasKey(key, now, stale)
+	})
 
-	return false
+	return
 }
 
 // HasIndex returns if the input index exists in the emap.
-func (m *UnlockEMap) HasIndex(index interface{}) bool {
-	if _, exist := m.indices[index]; exist {
-		return true
-	}
+func (m *UnlockEMap) HasIndex(index interface{}) (exist bool) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		exist = m.hasIndex(index, now, stale)
+	})
 
-	return false
+	return
 }
 
 // Insert pushes a new value into emap with input key and indices.
 // Input key must not be duplicated.
 // Input indices are optional.
 func (m *UnlockEMap) Insert(key interface{}, value interface{}, indices ...interface{}) error {
-	return insert(m.values, m.keys, m.indices, key, value, indices...)
+	return m.write(nopLocker{}, func() error {
+		return m.insert(key, value, indices...)
+	})
+}
+
+// Upsert pushes the value into emap with input key and indices.
+// If the key exists, its value is replaced in place and its indices are replaced by the input indices,
+// while the indices derived by the index extractors follow the new value.
+// Input indices are optional.
+func (m *UnlockEMap) Upsert(key interface{}, value interface{}, indices ...interface{}) error {
+	return m.write(nopLocker{}, func() error {
+		return m.upsert(key, value, indices...)
+	})
+}
+
+// Update replaces the value in the emap of the input key in place, the indices of the key are kept.
+// Try to update a non-existed key will cause an error return.
+func (m *UnlockEMap) Update(key interface{}, value interface{}) error {
+	return m.write(nopLocker{}, func() error {
+		return m.update(key, value)
+	})
+}
+
+// Compute replaces the value in the emap of the input key by the result of the callback function atomically.
+// The callback function is called with the current value and whether it exists, and returns the new value and whether to keep it.
+// If keep is false the value is deleted, otherwise it is replaced in place or inserted without indices.
+// The callback function is called with the locker held, so it must not call back into the emap.
+func (m *UnlockEMap) Compute(key interface{}, callback func(old interface{}, exist bool) (interface{}, bool)) error {
+	return m.write(nopLocker{}, func() error {
+		return m.compute(key, func(old interface{}, exist bool) (interface{}, bool, error) {
+			value, keep := callback(old, exist)
+			return value, keep, nil
+		})
+	})
+}
+
+// CompareAndSwap replaces the value in the emap of the input key only if the current value equals to old, and returns if swapped.
+// Values of uncomparable types, such as slices and maps, never equal.
+// Try to swap a non-existed key will cause an error return.
+func (m *UnlockEMap) CompareAndSwap(key interface{}, old interface{}, value interface{}) (swapped bool, err error) {
+	m.write(nopLocker{}, func() error {
+		swapped, err = m.compareAndSwap(key, old, value)
+		return err
+	})
+
+	return
+}
+
+// LoadOrStore returns the value in the emap of the input key if it exists and loaded is true.
+// Otherwise it pushes the input value into emap with input key and indices, and returns the input value.
+func (m *UnlockEMap) LoadOrStore(key interface{}, value interface{}, indices ...interface{}) (actual interface{}, loaded bool, err error) {
+	m.write(nopLocker{}, func() error {
+		actual, loaded, err = m.loadOrStore(key, value, indices...)
+		return err
+	})
+
+	return
+}
+
+// Txn runs the callback function as a transaction.
+// If the callback function returns an error, all the changes made by the transaction are rolled back and the error is returned.
+// The callback function should only change the emap through the input transaction.
+func (m *UnlockEMap) Txn(callback func(tx Tx[interface{}, interface{}, interface{}]) error) error {
+	return m.write(nopLocker{}, func() error {
+		return m.txn(&txn[interface{}, interface{}, interface{}]{store: &m.store}, callback)
+	})
 }
 
 // FetchByKey gets the value in the emap by input key.
 // Try to fetch a non-existed key will cause an error return.
-func (m *UnlockEMap) FetchByKey(key interface{}) (interface{}, error) {
-	return fetchByKey(m.values, key)
+func (m *UnlockEMap) FetchByKey(key interface{}) (value interface{}, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		value, err = m.fetchByKey(key, now, stale)
+	})
+
+	return
 }
 
 // FetchByIndex gets the all values in the emap by input index.
 // Try to fetch a non-existed index will cause an error return.
-func (m *UnlockEMap) FetchByIndex(index interface{}) ([]interface{}, error) {
-	return fetchByIndex(m.values, m.indices, index)
+func (m *UnlockEMap) FetchByIndex(index interface{}) (values []interface{}, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		values, err = m.fetchByIndex(index, now, stale)
+	})
+
+	return
+}
+
+// FetchOneByIndex gets the first value in the emap by input index, which is the only one if the index is unique.
+// Try to fetch a non-existed index will cause an error return.
+func (m *UnlockEMap) FetchOneByIndex(index interface{}) (value interface{}, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		value, err = m.fetchOneIn(m.indices, index, now, stale)
+	})
+
+	return
+}
+
+// FetchByIndexRange gets the values in the emap whose indices are between lo and hi inclusively, in the ascending order of the indices.
+// A value having more than one index in the range is returned only once, and an empty range returns no value without error.
+// Try to fetch from an emap created without WithOrderedIndex will cause an error return.
+func (m *UnlockEMap) FetchByIndexRange(lo, hi interface{}) (values []interface{}, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		values, err = m.fetchByIndexRange(lo, hi, now, stale)
+	})
+
+	return
+}
+
+// Min gets the smallest index in the emap and all the values of it.
+// Try to get from an emap without any index or created without WithOrderedIndex will cause an error return.
+func (m *UnlockEMap) Min() (index interface{}, values []interface{}, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		index, values, err = m.edge(false, now, stale)
+	})
+
+	return
+}
+
+// Max gets the largest index in the emap and all the values of it.
+// Try to get from an emap without any index or created without WithOrderedIndex will cause an error return.
+func (m *UnlockEMap) Max() (index interface{}, values []interface{}, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		index, values, err = m.edge(true, now, stale)
+	})
+
+	return
+}
+
+// Ascend applies the input callback function to each index-value pair in the ascending order of the indices until it returns false.
+// A value having more than one index is visited once for each of its indices.
+// The callback function must not call back into the emap.
+// Try to iterate an emap created without WithOrderedIndex will cause an error return.
+func (m *UnlockEMap) Ascend(callback func(interface{}, interface{}) bool) (err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		err = m.walk(false, callback, now, stale)
+	})
+
+	return
+}
+
+// Descend applies the input callback function to each index-value pair in the descending order of the indices until it returns false.
+// A value having more than one index is visited once for each of its indices.
+// The callback function must not call back into the emap.
+// Try to iterate an emap created without WithOrderedIndex will cause an error return.
+func (m *UnlockEMap) Descend(callback func(interface{}, interface{}) bool) (err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		err = m.walk(true, callback, now, stale)
+	})
+
+	return
+}
+
+// FetchByAllIndices gets the key-value pairs in the emap having all the input indices.
+// Try to fetch without any match will return no pair without error.
+func (m *UnlockEMap) FetchByAllIndices(indices ...interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		pairs = m.fetchByAllIndices(indices, now, stale)
+	})
+
+	return
+}
+
+// FetchByAnyIndex gets the key-value pairs in the emap having any of the input indices, each key is returned only once.
+// Try to fetch without any match will return no pair without error.
+func (m *UnlockEMap) FetchByAnyIndex(indices ...interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		pairs = m.fetchByAnyIndex(indices, now, stale)
+	})
+
+	return
+}
+
+// FetchExcept gets the key-value pairs in the emap having the input index but none of the excluded indices.
+// Try to fetch without any match will return no pair without error.
+func (m *UnlockEMap) FetchExcept(index interface{}, excluded ...interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		pairs = m.fetchExcept(index, excluded, now, stale)
+	})
+
+	return
+}
+
+// FetchKeysByIndex gets the all keys in the emap by input index.
+// Try to fetch a non-existed index will cause an error return.
+func (m *UnlockEMap) FetchKeysByIndex(index interface{}) (keys []interface{}, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		keys, err = m.fetchKeysByIndex(index, now, stale)
+	})
+
+	return
+}
+
+// FetchEntriesByIndex gets the all key-value pairs in the emap by input index.
+// Try to fetch a non-existed index will cause an error return.
+func (m *UnlockEMap) FetchEntriesByIndex(index interface{}) (pairs []KeyValue[interface{}, interface{}], err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		pairs, err = m.fetchEntriesByIndex(index, now, stale)
+	})
+
+	return
+}
+
+// FetchIndicesByKey gets the all indices in the emap by input key.
+// Try to fetch a non-existed key will cause an error return.
+func (m *UnlockEMap) FetchIndicesByKey(key interface{}) (indices []interface{}, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		indices, err = m.fetchIndicesByKey(key, now, stale)
+	})
+
+	return
 }
 
 // DeleteByKey deletes the value in the emap by input key.
 // Try to delete a non-existed key will cause an error return.
 func (m *UnlockEMap) DeleteByKey(key interface{}) error {
-	return deleteByKey(m.values, m.keys, m.indices, key)
+	return m.write(nopLocker{}, func() error {
+		return m.deleteByKey(key, EvictDeleted)
+	})
 }
 
 // DeleteByIndex deletes all the values in the emap by input index.
 // Try to delete a non-existed index will cause an error return.
 func (m *UnlockEMap) DeleteByIndex(index interface{}) error {
-	return deleteByIndex(m.values, m.keys, m.indices, index)
+	return m.write(nopLocker{}, func() error {
+		return m.deleteByIndex(index, EvictDeleted)
+	})
 }
 
 // AddIndex add the input index to the value in the emap of the input key.
 // Try to add a duplicate index will cause an error return.
 // Try to add an index to a non-existed value will cause an error return.
 func (m *UnlockEMap) AddIndex(key interface{}, index interface{}) error {
-	return addIndex(m.keys, m.indices, key, index)
+	return m.addIndex(key, index)
 }
 
 // RemoveIndex remove the input index from the value in the emap of the input key.
 // Try to delete a non-existed index will cause an error return.
 // Try to delete an index from a non-existed value will cause an error return.
 func (m *UnlockEMap) RemoveIndex(key interface{}, index interface{}) error {
-	return removeIndex(m.keys, m.indices, key, index)
+	return m.removeIndex(key, index)
+}
+
+// Index returns the named index family of the emap, which has its own index storage scoped to the family.
+// The index family is created on the first index added to it, and the empty name means the default indices of the emap.
+func (m *UnlockEMap) Index(name string) *IndexFamily[interface{}, interface{}, interface{}] {
+	return &IndexFamily[interface{}, interface{}, interface{}]{name: name, store: &m.store, locker: nopLocker{}}
+}
+
+// Query returns a new query on the emap, e.g. m.Query().Where(Index("region", "eu")).Filter(predicate).Limit(50).Fetch().
+func (m *UnlockEMap) Query() *Query {
+	return &Query{store: &m.store, locker: nopLocker{}}
+}
+
+// OnEvict registers the callback function which is called for each value removed from the emap,
+// with the key, value and indices of the removed value and the reason of the removal.
+// The callback function is called after the removal is finished, so it may safely call back into the emap.
+// Only one callback function is kept, a later call replaces the former one.
+func (m *UnlockEMap) OnEvict(callback func(key interface{}, value interface{}, indices []interface{}, reason EvictReason)) {
+	m.onEvict = callback
+}
+
+// Scan gets at most count key-value pairs in the order of insertion after the input cursor, 10 pairs if count is not positive.
+// Start a scan with cursor 0 and pass the returned cursor to the next call, until the returned cursor is 0 again.
+// The emap may be changed between the calls, and each value which exists during the whole scan is returned exactly once.
+func (m *UnlockEMap) Scan(cursor uint64, count int) (pairs []KeyValue[interface{}, interface{}], next uint64, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		pairs, next = m.scan(cursor, count, now, stale)
+	})
+
+	return
+}
+
+// ScanIndex gets at most count key-value pairs of the input index like Scan.
+// Each value which has the input index during the whole scan is returned exactly once.
+func (m *UnlockEMap) ScanIndex(index interface{}, cursor uint64, count int) (pairs []KeyValue[interface{}, interface{}], next uint64, err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		pairs, next = m.scanIndex(index, cursor, count, now, stale)
+	})
+
+	return
 }
 
 // Transform is a higher-order operation which apply the input callback function to each key-value pair in the emap.
@@ -122,5 +374,38 @@ func (m *UnlockEMap) Transform(callback func(interface{}, interface{}) (interfac
 // Since the callback function has no return, the foreach procedure will never be interrupted.
 // A typical usage of Foreach is apply a closure.
 func (m *UnlockEMap) Foreach(callback func(interface{}, interface{})) {
-	foreach(m.values, callback)
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		m.foreach(callback, now, stale)
+	})
+}
+
+// ForeachUntil applies the input callback function to each key-value pair in the emap until the callback function returns false.
+func (m *UnlockEMap) ForeachUntil(callback func(interface{}, interface{}) bool) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		m.foreachUntil(callback, now, stale)
+	})
+}
+
+// ForeachErr applies the input callback function to each key-value pair in the emap.
+// Any error returned by the callback function will interrupt the procedure and the error will be returned.
+func (m *UnlockEMap) ForeachErr(callback func(interface{}, interface{}) error) (err error) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		err = m.foreachErr(callback, now, stale)
+	})
+
+	return
+}
+
+// ForeachByIndex applies the input callback function to each key-value pair of the input index in the emap.
+// Only the keys of the input index are walked, and nothing is done for a non-existed index.
+func (m *UnlockEMap) ForeachByIndex(index interface{}, callback func(interface{}, interface{})) {
+	m.read(nopLocker{}, func(now time.Time, stale *[]interface{}) {
+		m.foreachByIndex(index, callback, now, stale)
+	})
+}
+
+// Snapshot returns a consistent read-only view of the emap which is not affected by the later changes of the emap.
+// Taking a snapshot copies nothing without lazy expiration, but the next change of the emap copies its storage once, which costs O(n).
+func (m *UnlockEMap) Snapshot() *Snapshot[interface{}, interface{}, interface{}] {
+	return m.snapshot(time.Now())
 }